@@ -0,0 +1,267 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"github.com/JamesDarcy616/dicom/dcmerr"
+)
+
+// The element with tag, with its value loaded if lazy
+func (ds *Dataset) loadedElement(tag uint32) (*Element, error) {
+	elem, ok := ds.elems[tag]
+	if !ok {
+		return nil, dcmerr.Errorf(dcmerr.ErrNotFound, "Element 0x%08x not found", tag)
+	}
+	if lazy, ok := elem.Value.(*lazyValue); ok {
+		if err := lazy.Load(); err != nil {
+			return nil, err
+		}
+	}
+	return elem, nil
+}
+
+// True for a value with no type of its own, any plural getter returns an empty
+// slice for it
+func isUntypedEmpty(value Value) bool {
+	_, ok := value.(*emptyValue)
+	return ok
+}
+
+// All values of the element with tag, failing with ErrNotConvertible unless
+// they are held as []T. The slice is a copy so may be modified by the caller.
+func getValues[T any](ds *Dataset, tag uint32) ([]T, error) {
+	values, err := sharedValues[T](ds, tag)
+	if err != nil {
+		return nil, err
+	}
+	return append([]T{}, values...), nil
+}
+
+// The values of the element with tag without copying, converting between
+// signed and unsigned 16 bit values for OW and xs which are read as one or the
+// other
+func sharedValues[T any](ds *Dataset, tag uint32) ([]T, error) {
+	elem, err := ds.loadedElement(tag)
+	if err != nil {
+		return nil, err
+	}
+	if isUntypedEmpty(elem.Value) {
+		return []T{}, nil
+	}
+	values, ok := elem.Value.GetAll().([]T)
+	if ok {
+		return values, nil
+	}
+	if elem.VR == "OW" || elem.VR == "xs" {
+		if values, ok := convertWords(elem.Value.GetAll()).([]T); ok {
+			return values, nil
+		}
+	}
+	return nil, dcmerr.Errorf(dcmerr.ErrNotConvertible,
+		"Cannot convert element 0x%08x with VR %v to %T", tag, elem.VR, values)
+}
+
+// Reinterpret []int16 as []uint16 and the reverse
+func convertWords(raw interface{}) interface{} {
+	switch raw := raw.(type) {
+	case []int16:
+		words := make([]uint16, len(raw))
+		for i, v := range raw {
+			words[i] = uint16(v)
+		}
+		return words
+	case []uint16:
+		words := make([]int16, len(raw))
+		for i, v := range raw {
+			words[i] = int16(v)
+		}
+		return words
+	}
+	return nil
+}
+
+// The value at index of the element with tag
+func getValue[T any](ds *Dataset, tag uint32, index int) (T, error) {
+	var zero T
+	values, err := sharedValues[T](ds, tag)
+	if err != nil {
+		return zero, err
+	}
+	if len(values) == 0 {
+		return zero, dcmerr.Errorf(dcmerr.ErrEmpty, "Element 0x%08x is empty", tag)
+	}
+	if index < 0 || index >= len(values) {
+		return zero, dcmerr.Errorf(dcmerr.ErrNotConvertible,
+			"Element 0x%08x has %v values, no value at index %v", tag, len(values), index)
+	}
+	return values[index], nil
+}
+
+// Put an element after checking vrStr is one of the VRs able to hold raw
+func (ds *Dataset) putValues(tag uint32, vrStr string, vl uint32, raw interface{}, vrs ...string) error {
+	if !containsVR(vrs, vrStr) {
+		return dcmerr.Errorf(dcmerr.ErrNotConvertible,
+			"VR %v can not hold a value of type %T", vrStr, raw)
+	}
+	value, err := NewValue(raw)
+	if err != nil {
+		return err
+	}
+	ds.Put(NewElement(tag, vrStr, vl, value))
+	return nil
+}
+
+func (ds *Dataset) GetUint16(tag uint32) (uint16, error) { return getValue[uint16](ds, tag, 0) }
+func (ds *Dataset) GetUint16At(tag uint32, index int) (uint16, error) {
+	return getValue[uint16](ds, tag, index)
+}
+func (ds *Dataset) GetUint16s(tag uint32) ([]uint16, error) { return getValues[uint16](ds, tag) }
+
+func (ds *Dataset) GetInt16(tag uint32) (int16, error) { return getValue[int16](ds, tag, 0) }
+func (ds *Dataset) GetInt16At(tag uint32, index int) (int16, error) {
+	return getValue[int16](ds, tag, index)
+}
+func (ds *Dataset) GetInt16s(tag uint32) ([]int16, error) { return getValues[int16](ds, tag) }
+
+func (ds *Dataset) GetUint32(tag uint32) (uint32, error) { return getValue[uint32](ds, tag, 0) }
+func (ds *Dataset) GetUint32At(tag uint32, index int) (uint32, error) {
+	return getValue[uint32](ds, tag, index)
+}
+func (ds *Dataset) GetUint32s(tag uint32) ([]uint32, error) { return getValues[uint32](ds, tag) }
+
+func (ds *Dataset) GetInt32(tag uint32) (int32, error) { return getValue[int32](ds, tag, 0) }
+func (ds *Dataset) GetInt32At(tag uint32, index int) (int32, error) {
+	return getValue[int32](ds, tag, index)
+}
+func (ds *Dataset) GetInt32s(tag uint32) ([]int32, error) { return getValues[int32](ds, tag) }
+
+func (ds *Dataset) GetUint64(tag uint32) (uint64, error) { return getValue[uint64](ds, tag, 0) }
+func (ds *Dataset) GetUint64At(tag uint32, index int) (uint64, error) {
+	return getValue[uint64](ds, tag, index)
+}
+func (ds *Dataset) GetUint64s(tag uint32) ([]uint64, error) { return getValues[uint64](ds, tag) }
+
+func (ds *Dataset) GetInt64(tag uint32) (int64, error) { return getValue[int64](ds, tag, 0) }
+func (ds *Dataset) GetInt64At(tag uint32, index int) (int64, error) {
+	return getValue[int64](ds, tag, index)
+}
+func (ds *Dataset) GetInt64s(tag uint32) ([]int64, error) { return getValues[int64](ds, tag) }
+
+func (ds *Dataset) GetFloat32(tag uint32) (float32, error) { return getValue[float32](ds, tag, 0) }
+func (ds *Dataset) GetFloat32At(tag uint32, index int) (float32, error) {
+	return getValue[float32](ds, tag, index)
+}
+func (ds *Dataset) GetFloat32s(tag uint32) ([]float32, error) { return getValues[float32](ds, tag) }
+
+func (ds *Dataset) GetFloat64(tag uint32) (float64, error) { return getValue[float64](ds, tag, 0) }
+func (ds *Dataset) GetFloat64At(tag uint32, index int) (float64, error) {
+	return getValue[float64](ds, tag, index)
+}
+func (ds *Dataset) GetFloat64s(tag uint32) ([]float64, error) { return getValues[float64](ds, tag) }
+
+func (ds *Dataset) GetAttributeTag(tag uint32) (AttributeTag, error) {
+	return getValue[AttributeTag](ds, tag, 0)
+}
+func (ds *Dataset) GetAttributeTagAt(tag uint32, index int) (AttributeTag, error) {
+	return getValue[AttributeTag](ds, tag, index)
+}
+func (ds *Dataset) GetAttributeTags(tag uint32) ([]AttributeTag, error) {
+	return getValues[AttributeTag](ds, tag)
+}
+
+// The value of an element held as bytes, such as OB or UN
+func (ds *Dataset) GetBytes(tag uint32) ([]byte, error) { return getValues[byte](ds, tag) }
+
+// The items of an SQ element
+func (ds *Dataset) GetSequence(tag uint32) ([]*Dataset, error) {
+	return getValues[*Dataset](ds, tag)
+}
+func (ds *Dataset) GetSequenceItem(tag uint32, index int) (*Dataset, error) {
+	return getValue[*Dataset](ds, tag, index)
+}
+
+// The VR is checked against the type of the values, ambiguous VRs from
+// dcmtk.dic are not accepted
+func (ds *Dataset) PutUint16s(tag uint32, vrStr string, values ...uint16) error {
+	return ds.putValues(tag, vrStr, uint32(2*len(values)), values, "US", "OW")
+}
+
+func (ds *Dataset) PutInt16s(tag uint32, vrStr string, values ...int16) error {
+	return ds.putValues(tag, vrStr, uint32(2*len(values)), values, "SS", "OW")
+}
+
+func (ds *Dataset) PutUint32s(tag uint32, vrStr string, values ...uint32) error {
+	return ds.putValues(tag, vrStr, uint32(4*len(values)), values, "UL", "OL")
+}
+
+func (ds *Dataset) PutInt32s(tag uint32, vrStr string, values ...int32) error {
+	return ds.putValues(tag, vrStr, uint32(4*len(values)), values, "SL")
+}
+
+func (ds *Dataset) PutUint64s(tag uint32, vrStr string, values ...uint64) error {
+	return ds.putValues(tag, vrStr, uint32(8*len(values)), values, "UV", "OV")
+}
+
+func (ds *Dataset) PutInt64s(tag uint32, vrStr string, values ...int64) error {
+	return ds.putValues(tag, vrStr, uint32(8*len(values)), values, "SV")
+}
+
+func (ds *Dataset) PutFloat32s(tag uint32, vrStr string, values ...float32) error {
+	return ds.putValues(tag, vrStr, uint32(4*len(values)), values, "FL", "OF")
+}
+
+func (ds *Dataset) PutFloat64s(tag uint32, vrStr string, values ...float64) error {
+	return ds.putValues(tag, vrStr, uint32(8*len(values)), values, "FD", "OD")
+}
+
+func (ds *Dataset) PutAttributeTags(tag uint32, values ...AttributeTag) error {
+	return ds.putValues(tag, "AT", uint32(4*len(values)), values, "AT")
+}
+
+// Put an OB or UN element, OW is put with PutUint16s or PutInt16s
+func (ds *Dataset) PutBytes(tag uint32, vrStr string, value []byte) error {
+	return ds.putValues(tag, vrStr, uint32(len(value)), value, "OB", "UN")
+}
+
+// Put an SQ element written with undefined length
+func (ds *Dataset) PutSequence(tag uint32, items ...*Dataset) error {
+	return ds.putValues(tag, "SQ", UndefinedLength, items, "SQ")
+}
+
+func containsVR(vrs []string, vrStr string) bool {
+	for _, v := range vrs {
+		if v == vrStr {
+			return true
+		}
+	}
+	return false
+}
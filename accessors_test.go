@@ -0,0 +1,242 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
+)
+
+// Empty elements of each VR, typed as read from a zero length value and
+// untyped as created by NewValue(nil)
+func emptyDataset(t *testing.T, vr string) *Dataset {
+	ds := NewDataset()
+	switch vr {
+	case "US":
+		ds.PutUint16s(0x00280010, vr)
+	case "SS":
+		ds.PutInt16s(0x00280010, vr)
+	case "UL":
+		ds.PutUint32s(0x00280010, vr)
+	case "SL":
+		ds.PutInt32s(0x00280010, vr)
+	case "UV":
+		ds.PutUint64s(0x00280010, vr)
+	case "SV":
+		ds.PutInt64s(0x00280010, vr)
+	case "FL":
+		ds.PutFloat32s(0x00280010, vr)
+	case "FD":
+		ds.PutFloat64s(0x00280010, vr)
+	case "AT":
+		ds.PutAttributeTags(0x00280010)
+	case "OB":
+		ds.PutBytes(0x00280010, "OB", nil)
+	case "SQ":
+		ds.PutSequence(0x00280010)
+	case "":
+		ds.Put(testElement(t, 0x00280010, "UN", nil))
+	default:
+		ds.PutString(0x00280010, vr, "")
+	}
+	return ds
+}
+
+func TestEmptyAccessors(t *testing.T) {
+	singular := map[string]func(*Dataset) (interface{}, error){
+		"US": func(ds *Dataset) (interface{}, error) { return ds.GetUint16(0x00280010) },
+		"SS": func(ds *Dataset) (interface{}, error) { return ds.GetInt16(0x00280010) },
+		"UL": func(ds *Dataset) (interface{}, error) { return ds.GetUint32(0x00280010) },
+		"SL": func(ds *Dataset) (interface{}, error) { return ds.GetInt32At(0x00280010, 0) },
+		"UV": func(ds *Dataset) (interface{}, error) { return ds.GetUint64(0x00280010) },
+		"SV": func(ds *Dataset) (interface{}, error) { return ds.GetInt64(0x00280010) },
+		"FL": func(ds *Dataset) (interface{}, error) { return ds.GetFloat32(0x00280010) },
+		"FD": func(ds *Dataset) (interface{}, error) { return ds.GetFloat64(0x00280010) },
+		"AT": func(ds *Dataset) (interface{}, error) { return ds.GetAttributeTag(0x00280010) },
+		"SQ": func(ds *Dataset) (interface{}, error) { return ds.GetSequenceItem(0x00280010, 0) },
+		"LO": func(ds *Dataset) (interface{}, error) { return ds.GetString(0x00280010) },
+		"DA": func(ds *Dataset) (interface{}, error) { return ds.GetDate(0x00280010) },
+		"TM": func(ds *Dataset) (interface{}, error) { return ds.GetTime(0x00280010) },
+		"DT": func(ds *Dataset) (interface{}, error) { return ds.GetDateTime(0x00280010) },
+		"PN": func(ds *Dataset) (interface{}, error) { return ds.GetPersonName(0x00280010) },
+		"AS": func(ds *Dataset) (interface{}, error) { return ds.GetAge(0x00280010) },
+	}
+	for vr, get := range singular {
+		for _, ds := range []*Dataset{emptyDataset(t, vr), emptyDataset(t, "")} {
+			if _, err := get(ds); !dcmerr.IsErrEmpty(err) {
+				t.Errorf("%v: got %v, want ErrEmpty", vr, err)
+			}
+		}
+	}
+
+	plural := map[string]func(*Dataset) (interface{}, error){
+		"US": func(ds *Dataset) (interface{}, error) { return ds.GetUint16s(0x00280010) },
+		"SS": func(ds *Dataset) (interface{}, error) { return ds.GetInt16s(0x00280010) },
+		"UL": func(ds *Dataset) (interface{}, error) { return ds.GetUint32s(0x00280010) },
+		"SL": func(ds *Dataset) (interface{}, error) { return ds.GetInt32s(0x00280010) },
+		"UV": func(ds *Dataset) (interface{}, error) { return ds.GetUint64s(0x00280010) },
+		"SV": func(ds *Dataset) (interface{}, error) { return ds.GetInt64s(0x00280010) },
+		"FL": func(ds *Dataset) (interface{}, error) { return ds.GetFloat32s(0x00280010) },
+		"FD": func(ds *Dataset) (interface{}, error) { return ds.GetFloat64s(0x00280010) },
+		"AT": func(ds *Dataset) (interface{}, error) { return ds.GetAttributeTags(0x00280010) },
+		"OB": func(ds *Dataset) (interface{}, error) { return ds.GetBytes(0x00280010) },
+		"SQ": func(ds *Dataset) (interface{}, error) { return ds.GetSequence(0x00280010) },
+		"LO": func(ds *Dataset) (interface{}, error) { return ds.GetStrings(0x00280010) },
+		"PN": func(ds *Dataset) (interface{}, error) { return ds.GetPersonNames(0x00280010) },
+		"DS": func(ds *Dataset) (interface{}, error) { return ds.GetFloats(0x00280010) },
+		"IS": func(ds *Dataset) (interface{}, error) { return ds.GetInts(0x00280010) },
+	}
+	for vr, get := range plural {
+		for _, ds := range []*Dataset{emptyDataset(t, vr), emptyDataset(t, "")} {
+			values, err := get(ds)
+			if err != nil {
+				t.Errorf("%v: %v", vr, err)
+				continue
+			}
+			if v := reflect.ValueOf(values); v.Kind() != reflect.Slice || v.Len() != 0 {
+				t.Errorf("%v: got %#v, want an empty slice", vr, values)
+			}
+		}
+	}
+	// Binary numeric empty values convert to empty slices too
+	for _, vr := range []string{"US", "SS", "UL", "SL", "UV", "SV", "FL", "FD"} {
+		if values, err := emptyDataset(t, vr).GetFloats(0x00280010); err != nil || len(values) != 0 {
+			t.Errorf("%v GetFloats: %v, %v", vr, values, err)
+		}
+		if values, err := emptyDataset(t, vr).GetInts(0x00280010); err != nil || len(values) != 0 {
+			t.Errorf("%v GetInts: %v, %v", vr, values, err)
+		}
+	}
+}
+
+func TestPutVR(t *testing.T) {
+	ds := NewDataset()
+	puts := []struct {
+		vr  string
+		err error
+	}{
+		{"OF", ds.PutFloat32s(tag.FloatPixelData, "OF", 1.5, -2)},
+		{"OD", ds.PutFloat64s(tag.DoubleFloatPixelData, "OD", 0.25)},
+		{"OL", ds.PutUint32s(tag.LongPrimitivePointIndexList, "OL", 1, 2, 3)},
+		{"OV", ds.PutUint64s(tag.ExtendedOffsetTable, "OV", 0, 1024)},
+		{"OW", ds.PutUint16s(tag.RedPaletteColorLookupTableData, "OW", 1, 65535)},
+		{"OB", ds.PutBytes(tag.PixelData, "OB", []byte{1, 2, 3, 4})},
+		{"FD", ds.PutFloat64s(tag.TimeRange, "FD", 2.5)},
+	}
+	for _, put := range puts {
+		if put.err != nil {
+			t.Errorf("%v: %v", put.vr, put.err)
+		}
+	}
+	for _, err := range []error{
+		ds.PutFloat32s(tag.TimeRange, "FD", 1),
+		ds.PutUint16s(tag.Rows, "SS", 1),
+		ds.PutBytes(tag.PixelData, "OF", nil),
+		ds.PutBytes(tag.PixelData, "OW", nil),
+		ds.PutInt32s(tag.Rows, "UL", 1),
+	} {
+		if !dcmerr.IsErrNotConvertible(err) {
+			t.Errorf("got %v, want ErrNotConvertible", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, ds, true); err != nil {
+		t.Fatal(err)
+	}
+	out, err := NewParser().Parse(&buf, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		tag32 uint32
+		get   func(*Dataset) (interface{}, error)
+		want  interface{}
+	}{
+		{tag.FloatPixelData, func(ds *Dataset) (interface{}, error) { return ds.GetFloat32s(tag.FloatPixelData) }, []float32{1.5, -2}},
+		{tag.DoubleFloatPixelData, func(ds *Dataset) (interface{}, error) { return ds.GetFloat64s(tag.DoubleFloatPixelData) }, []float64{0.25}},
+		{tag.LongPrimitivePointIndexList, func(ds *Dataset) (interface{}, error) { return ds.GetUint32s(tag.LongPrimitivePointIndexList) }, []uint32{1, 2, 3}},
+		{tag.ExtendedOffsetTable, func(ds *Dataset) (interface{}, error) { return ds.GetUint64s(tag.ExtendedOffsetTable) }, []uint64{0, 1024}},
+		{tag.RedPaletteColorLookupTableData, func(ds *Dataset) (interface{}, error) { return ds.GetUint16s(tag.RedPaletteColorLookupTableData) }, []uint16{1, 65535}},
+		{tag.RedPaletteColorLookupTableData, func(ds *Dataset) (interface{}, error) { return ds.GetInt16s(tag.RedPaletteColorLookupTableData) }, []int16{1, -1}},
+		{tag.PixelData, func(ds *Dataset) (interface{}, error) { return ds.GetBytes(tag.PixelData) }, []byte{1, 2, 3, 4}},
+		{tag.TimeRange, func(ds *Dataset) (interface{}, error) { return ds.GetFloat64s(tag.TimeRange) }, []float64{2.5}},
+	} {
+		want, _ := ds.Get(c.tag32)
+		got, err := out.Get(c.tag32)
+		if err != nil {
+			t.Errorf("%08x: %v", c.tag32, err)
+			continue
+		}
+		if got.VR != want.VR {
+			t.Errorf("%08x: VR %v, want %v", c.tag32, got.VR, want.VR)
+		}
+		values, err := c.get(out)
+		if err != nil || !reflect.DeepEqual(values, c.want) {
+			t.Errorf("%08x: got %v %v, want %v", c.tag32, values, err, c.want)
+		}
+	}
+}
+
+func TestGetConvertsWords(t *testing.T) {
+	// Implicit VR xs is read as US
+	data := []byte{0x28, 0x00, 0x06, 0x01, 2, 0, 0, 0, 0xfd, 0xff}
+	ds, err := NewParser().Parse(bytes.NewReader(data), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := ds.GetInt16(tag.SmallestImagePixelValue); err != nil || v != -3 {
+		t.Errorf("GetInt16 %v, %v", v, err)
+	}
+	if v, err := ds.GetUint16(tag.SmallestImagePixelValue); err != nil || v != 65533 {
+		t.Errorf("GetUint16 %v, %v", v, err)
+	}
+	// Other VRs are not converted
+	ds.PutUint16s(tag.Rows, "US", 1)
+	if _, err := ds.GetInt16(tag.Rows); !dcmerr.IsErrNotConvertible(err) {
+		t.Errorf("GetInt16 of US: %v", err)
+	}
+}
+
+func TestGetValuesCopy(t *testing.T) {
+	ds := NewDataset()
+	ds.PutFloat64s(tag.TimeRange, "FD", 1, 2)
+	values, _ := ds.GetFloat64s(tag.TimeRange)
+	values[0] = 100
+	if v, _ := ds.GetFloat64(tag.TimeRange); v != 1 {
+		t.Errorf("dataset modified through the returned slice, value %v", v)
+	}
+}
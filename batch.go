@@ -0,0 +1,104 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// The outcome of parsing one file with BatchParse
+type BatchResult struct {
+	Path     string
+	Dataset  *Dataset
+	Warnings []Warning
+	// Why the file failed to parse, nil on success. In lenient mode Dataset
+	// may hold a partial dataset.
+	Err      error
+	Duration time.Duration
+}
+
+// Parse the files received from paths using workers goroutines, each with its
+// own Parser and read buffer. Results are sent in completion order and the
+// channel is closed once paths is closed and drained, or ctx is cancelled in
+// which case results not yet received are dropped. If workers is less than 1
+// runtime.NumCPU() is used.
+func BatchParse(ctx context.Context, paths <-chan string, workers int, opts ParseOptions) <-chan BatchResult {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	results := make(chan BatchResult, workers)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			batchWorker(ctx, paths, results, NewParserWithOptions(opts))
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+func batchWorker(ctx context.Context, paths <-chan string, results chan<- BatchResult, p *Parser) {
+	for {
+		var path string
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return
+		case path, ok = <-paths:
+			if !ok {
+				return
+			}
+		}
+		start := time.Now()
+		ds, err := p.ParseFileContext(ctx, path)
+		result := BatchResult{
+			Path:     path,
+			Dataset:  ds,
+			Warnings: p.Warnings(),
+			Err:      err,
+			Duration: time.Since(start),
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case results <- result:
+		}
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
+	"github.com/JamesDarcy616/dicom/uid"
+)
+
+// Files each with their index as PatientID and one file that isn't DICOM
+func batchFiles(t *testing.T, n int) (map[string]string, string) {
+	t.Helper()
+	ids := make(map[string]string)
+	for i := 0; i < n; i++ {
+		ds := NewDataset()
+		ds.Put(testElement(t, tag.PatientID, "LO", fmt.Sprint(i)))
+		ids[testFile(t, ds, uid.ExplicitVRLittleEndian)] = fmt.Sprint(i)
+	}
+	bad := filepath.Join(t.TempDir(), "bad.dcm")
+	if err := os.WriteFile(bad, []byte("not a DICOM file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return ids, bad
+}
+
+func sendPaths(paths ...string) <-chan string {
+	ch := make(chan string, len(paths))
+	for _, path := range paths {
+		ch <- path
+	}
+	close(ch)
+	return ch
+}
+
+func TestBatchParse(t *testing.T) {
+	ids, bad := batchFiles(t, 8)
+	paths := []string{bad}
+	for path := range ids {
+		paths = append(paths, path)
+	}
+
+	seen := make(map[string]bool)
+	for result := range BatchParse(context.Background(), sendPaths(paths...), 3, ParseOptions{}) {
+		if seen[result.Path] {
+			t.Errorf("%v parsed twice", result.Path)
+		}
+		seen[result.Path] = true
+		if result.Duration <= 0 {
+			t.Errorf("%v: Duration %v", result.Path, result.Duration)
+		}
+		if result.Path == bad {
+			if result.Err == nil || result.Dataset != nil {
+				t.Errorf("bad file: %v %v", result.Dataset, result.Err)
+			}
+			continue
+		}
+		if result.Err != nil {
+			t.Errorf("%v: %v", result.Path, result.Err)
+			continue
+		}
+		if id, _ := result.Dataset.GetString(tag.PatientID); id != ids[result.Path] {
+			t.Errorf("%v: PatientID %v, want %v", result.Path, id, ids[result.Path])
+		}
+	}
+	if len(seen) != len(paths) {
+		t.Errorf("%v results, want %v", len(seen), len(paths))
+	}
+}
+
+func TestBatchParseWorkers(t *testing.T) {
+	for _, c := range []struct{ workers, want int }{{1, 1}, {4, 4}, {0, runtime.NumCPU()}} {
+		before := runtime.NumGoroutine()
+		paths := make(chan string)
+		results := BatchParse(context.Background(), paths, c.workers, ParseOptions{})
+		// The workers and the goroutine closing results
+		if got := runtime.NumGoroutine() - before; got != c.want+1 {
+			t.Errorf("workers %v: %v goroutines, want %v", c.workers, got, c.want+1)
+		}
+		close(paths)
+		for range results {
+		}
+	}
+}
+
+func TestBatchParseCancelled(t *testing.T) {
+	ids, _ := batchFiles(t, 8)
+	paths := []string{}
+	for path := range ids {
+		paths = append(paths, path)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := BatchParse(ctx, sendPaths(paths...), 2, ParseOptions{})
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				return
+			}
+			// A worker may take a path before seeing the cancellation
+			if !dcmerr.IsErrCancelled(result.Err) {
+				t.Errorf("%v: %v", result.Path, result.Err)
+			}
+		case <-timeout:
+			t.Fatal("results not closed after cancel")
+		}
+	}
+}
@@ -0,0 +1,518 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+const escape = 0x1b
+
+// A character set that may be designated to G0 or G1 by ISO 2022 code
+// extensions
+type codeElement struct {
+	// Escape sequence designating the element, without the leading ESC
+	escape string
+	g1     bool
+	// Decode a run of bytes all in G0 (< 0x80) or all in G1
+	decode func(b []byte) string
+	// Encode a single rune, returns false if it is not in the element
+	encode func(r rune) ([]byte, bool)
+}
+
+var (
+	asciiElement = &codeElement{
+		escape: "(B",
+		decode: func(b []byte) string { return string(b) },
+		encode: encodeASCII,
+	}
+	// JIS X 0201 romaji is read as ASCII so backslash remains a delimiter
+	romajiElement = &codeElement{
+		escape: "(J",
+		decode: func(b []byte) string { return string(b) },
+		encode: encodeASCII,
+	}
+	katakanaElement = &codeElement{
+		escape: ")I",
+		g1:     true,
+		decode: decodeKatakana,
+		encode: encodeKatakana,
+	}
+	jis0208Element = &codeElement{
+		escape: "$B",
+		decode: decodeJIS0208,
+		encode: encodeJIS0208,
+	}
+	jis0212Element = &codeElement{
+		escape: "$(D",
+		decode: decodeJIS0212,
+		encode: encodeJIS0212,
+	}
+	ksx1001Element = &codeElement{
+		escape: "$)C",
+		g1:     true,
+		decode: decoderFunc(korean.EUCKR),
+		encode: encoderFunc(korean.EUCKR),
+	}
+	gb2312Element = &codeElement{
+		escape: "$)A",
+		g1:     true,
+		decode: decoderFunc(simplifiedchinese.GBK),
+		encode: encoderFunc(simplifiedchinese.GBK),
+	}
+)
+
+// Code elements by the ISO-IR number of their defined term
+var codeElements = map[string]*codeElement{
+	"IR 6":   asciiElement,
+	"IR 13":  katakanaElement,
+	"IR 87":  jis0208Element,
+	"IR 159": jis0212Element,
+	"IR 149": ksx1001Element,
+	"IR 58":  gb2312Element,
+	"IR 100": singleByteElement("-A", charmap.ISO8859_1),
+	"IR 101": singleByteElement("-B", charmap.ISO8859_2),
+	"IR 109": singleByteElement("-C", charmap.ISO8859_3),
+	"IR 110": singleByteElement("-D", charmap.ISO8859_4),
+	"IR 144": singleByteElement("-L", charmap.ISO8859_5),
+	"IR 127": singleByteElement("-G", charmap.ISO8859_6),
+	"IR 126": singleByteElement("-F", charmap.ISO8859_7),
+	"IR 138": singleByteElement("-H", charmap.ISO8859_8),
+	"IR 148": singleByteElement("-M", charmap.ISO8859_9),
+	"IR 203": singleByteElement("-b", charmap.ISO8859_15),
+	"IR 166": singleByteElement("-T", charmap.Windows874),
+}
+
+// Code elements by escape sequence, all are recognised when decoding
+var escapeSequences = map[string]*codeElement{}
+
+func init() {
+	escapeSequences[romajiElement.escape] = romajiElement
+	for _, elem := range codeElements {
+		escapeSequences[elem.escape] = elem
+	}
+}
+
+// The character set of a dataset from its SpecificCharacterSet
+type charset struct {
+	utf8 bool
+	// Multi-byte character sets without code extensions
+	whole encoding.Encoding
+	// Initial code elements, g1 may be nil
+	g0 *codeElement
+	g1 *codeElement
+	// Code elements that may be switched to with escape sequences, set
+	// only with code extensions
+	extensions []*codeElement
+}
+
+// Create the charset for the values of SpecificCharacterSet, returns false if
+// any term is not recognised
+func newCharset(value string) (*charset, bool) {
+	terms := strings.Split(value, "\\")
+	for i := range terms {
+		terms[i] = strings.TrimSpace(terms[i])
+	}
+	cs := &charset{g0: asciiElement}
+	switch first := terms[0]; first {
+	case "", "ISO_IR 6":
+	case "ISO_IR 192":
+		cs.utf8 = true
+	case "GB18030":
+		cs.whole = simplifiedchinese.GB18030
+	case "GBK":
+		cs.whole = simplifiedchinese.GBK
+	case "ISO_IR 13", "ISO 2022 IR 13":
+		cs.g0, cs.g1 = romajiElement, katakanaElement
+	default:
+		elem, ok := codeElements[strings.TrimPrefix(strings.TrimPrefix(first, "ISO_IR "), "ISO 2022 ")]
+		if !ok {
+			elem, ok = codeElements["IR "+strings.TrimPrefix(first, "ISO_IR ")]
+		}
+		if !ok {
+			return nil, false
+		}
+		if elem.g1 {
+			cs.g1 = elem
+		} else {
+			cs.g0 = elem
+		}
+	}
+	if len(terms) == 1 {
+		return cs, true
+	}
+	cs.extensions = append(cs.extensions, cs.g0)
+	if cs.g1 != nil {
+		cs.extensions = append(cs.extensions, cs.g1)
+	}
+	// Further terms are designated by escape sequences
+	for _, term := range terms[1:] {
+		switch term {
+		case "":
+			cs.extensions = append(cs.extensions, asciiElement)
+		case "ISO 2022 IR 13":
+			cs.extensions = append(cs.extensions, romajiElement, katakanaElement)
+		default:
+			elem, ok := codeElements[strings.TrimPrefix(term, "ISO 2022 ")]
+			if !ok || !strings.HasPrefix(term, "ISO 2022 ") {
+				return nil, false
+			}
+			cs.extensions = append(cs.extensions, elem)
+		}
+	}
+	return cs, true
+}
+
+// Decode b to UTF-8, switching code elements at ISO 2022 escape sequences
+func (cs *charset) decode(b []byte) string {
+	if cs.utf8 {
+		return string(b)
+	}
+	if cs.whole != nil {
+		return decoderFunc(cs.whole)(b)
+	}
+	var sb strings.Builder
+	sb.Grow(len(b))
+	g0, g1 := cs.g0, cs.g1
+	start := 0
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] == escape:
+			elem, n := parseEscape(b[i+1:])
+			if n == 0 {
+				continue
+			}
+			decodeRun(&sb, b[start:i], g0, g1)
+			if elem.g1 {
+				g1 = elem
+			} else {
+				g0 = elem
+			}
+			i += n
+			start = i + 1
+		case isResetDelimiter(rune(b[i])) && (g0 == asciiElement || g0 == romajiElement):
+			// Initial code elements are active after delimiters
+			decodeRun(&sb, b[start:i+1], g0, g1)
+			g0, g1 = cs.g0, cs.g1
+			start = i + 1
+		}
+	}
+	decodeRun(&sb, b[start:], g0, g1)
+	return sb.String()
+}
+
+// Encode s from UTF-8, fails with ErrNotRepresentable if a character is not
+// in the character set
+func (cs *charset) encode(s string) ([]byte, error) {
+	if cs.utf8 {
+		return []byte(s), nil
+	}
+	if cs.whole != nil {
+		b, err := cs.whole.NewEncoder().Bytes([]byte(s))
+		if err != nil {
+			return nil, dcmerr.Errorf(dcmerr.ErrNotRepresentable,
+				"cannot encode %q - %v", s, err.Error())
+		}
+		return b, nil
+	}
+	b := make([]byte, 0, len(s))
+	g0, g1 := cs.g0, cs.g1
+	for _, r := range s {
+		if isResetDelimiter(r) {
+			// Switch back to the initial code elements before delimiters
+			if g0 != cs.g0 {
+				b = append(b, escape)
+				b = append(b, cs.g0.escape...)
+			}
+			b = append(b, byte(r))
+			g0, g1 = cs.g0, cs.g1
+			continue
+		}
+		if enc, ok := g0.encode(r); ok {
+			b = append(b, enc...)
+			continue
+		}
+		if g1 != nil {
+			if enc, ok := g1.encode(r); ok {
+				b = append(b, enc...)
+				continue
+			}
+		}
+		elem, enc := cs.findElement(r)
+		if elem == nil {
+			return nil, dcmerr.Errorf(dcmerr.ErrNotRepresentable,
+				"cannot encode %q in %q", r, s)
+		}
+		b = append(b, escape)
+		b = append(b, elem.escape...)
+		b = append(b, enc...)
+		if elem.g1 {
+			g1 = elem
+		} else {
+			g0 = elem
+		}
+	}
+	if g0 != cs.g0 {
+		b = append(b, escape)
+		b = append(b, cs.g0.escape...)
+	}
+	return b, nil
+}
+
+// The first code element able to encode r, only when using code extensions
+func (cs *charset) findElement(r rune) (*codeElement, []byte) {
+	for _, elem := range cs.extensions {
+		if enc, ok := elem.encode(r); ok {
+			return elem, enc
+		}
+	}
+	return nil, nil
+}
+
+// Set SpecificCharacterSet of ds and any of its items to target, after
+// checking all text values can be encoded in it. Fails with
+// ErrNotRepresentable, leaving ds unchanged, if any character can not be.
+func Transcode(ds *Dataset, target string) error {
+	cs, ok := newCharset(target)
+	if !ok {
+		return dcmerr.Errorf(dcmerr.ErrUnsupported, "unsupported SpecificCharacterSet %q", target)
+	}
+	if err := checkEncodable(ds, cs); err != nil {
+		return err
+	}
+	return setSpecificCharacterSet(ds, target, true)
+}
+
+func checkEncodable(ds *Dataset, cs *charset) error {
+	iter := ds.Iterator()
+	for iter.Next() {
+		elem := iter.Value()
+		// Sequences are never lazy, other values are only loaded if text
+		if sq, ok := elem.Value.(*sqValue); ok {
+			for _, item := range sq.value {
+				if err := checkEncodable(item, cs); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !isTextVR(elem.VR) {
+			continue
+		}
+		value, err := resolveValue(elem.Value)
+		if err != nil {
+			return err
+		}
+		if value, ok := value.(*stringValue); ok {
+			if _, err := cs.encode(value.value); err != nil {
+				return dcmerr.Errorf(dcmerr.ErrNotRepresentable,
+					"error encoding element 0x%08x - %v", elem.Tag, err.Error())
+			}
+		}
+	}
+	return iter.Err()
+}
+
+// Items keep inheriting the character set unless they specify their own
+func setSpecificCharacterSet(ds *Dataset, target string, top bool) error {
+	if _, err := ds.Get(tag.SpecificCharacterSet); err == nil || top {
+		if err := ds.PutString(tag.SpecificCharacterSet, "CS", target); err != nil {
+			return err
+		}
+	}
+	iter := ds.Iterator()
+	for iter.Next() {
+		sq, ok := iter.Value().Value.(*sqValue)
+		if !ok {
+			continue
+		}
+		for _, item := range sq.value {
+			if err := setSpecificCharacterSet(item, target, false); err != nil {
+				return err
+			}
+		}
+	}
+	return iter.Err()
+}
+
+// Text VRs are decoded and encoded using SpecificCharacterSet
+func isTextVR(vr string) bool {
+	switch vr {
+	case "LO", "LT", "PN", "SH", "ST", "UC", "UT":
+		return true
+	}
+	return false
+}
+
+// Delimiters after which the initial code elements are active
+func isResetDelimiter(r rune) bool {
+	switch r {
+	case '\\', '=', '\r', '\n', '\t', '\f':
+		return true
+	}
+	return false
+}
+
+// Decode a run without escape sequences, G0 bytes are < 0x80
+func decodeRun(sb *strings.Builder, b []byte, g0, g1 *codeElement) {
+	for len(b) > 0 {
+		high := b[0] >= 0x80
+		n := 1
+		for n < len(b) && (b[n] >= 0x80) == high {
+			n++
+		}
+		if high && g1 != nil {
+			sb.WriteString(g1.decode(b[:n]))
+		} else if high {
+			sb.Write(b[:n])
+		} else {
+			sb.WriteString(g0.decode(b[:n]))
+		}
+		b = b[n:]
+	}
+}
+
+// Match the escape sequence following an ESC, returns its length or 0
+func parseEscape(b []byte) (*codeElement, int) {
+	for _, n := range []int{2, 3} {
+		if len(b) < n {
+			break
+		}
+		if elem, ok := escapeSequences[string(b[:n])]; ok {
+			return elem, n
+		}
+	}
+	return nil, 0
+}
+
+func singleByteElement(escape string, cm *charmap.Charmap) *codeElement {
+	return &codeElement{
+		escape: escape,
+		g1:     true,
+		decode: decoderFunc(cm),
+		encode: func(r rune) ([]byte, bool) {
+			c, ok := cm.EncodeRune(r)
+			if !ok || c < 0x80 {
+				return nil, false
+			}
+			return []byte{c}, true
+		},
+	}
+}
+
+func decoderFunc(enc encoding.Encoding) func(b []byte) string {
+	return func(b []byte) string {
+		s, err := enc.NewDecoder().Bytes(b)
+		if err != nil {
+			return string(b)
+		}
+		return string(s)
+	}
+}
+
+// Encodes runes to the two byte G1 form used by EUC encodings
+func encoderFunc(enc encoding.Encoding) func(r rune) ([]byte, bool) {
+	return func(r rune) ([]byte, bool) {
+		b, err := enc.NewEncoder().Bytes([]byte(string(r)))
+		if err != nil || len(b) != 2 || b[0] < 0xa1 || b[1] < 0xa1 {
+			return nil, false
+		}
+		return b, true
+	}
+}
+
+func encodeASCII(r rune) ([]byte, bool) {
+	if r >= utf8.RuneSelf {
+		return nil, false
+	}
+	return []byte{byte(r)}, true
+}
+
+// JIS X 0201 katakana in G1, as EUC-JP single shift 2 sequences
+func decodeKatakana(b []byte) string {
+	euc := make([]byte, 0, len(b)*2)
+	for _, c := range b {
+		euc = append(euc, 0x8e, c)
+	}
+	return decoderFunc(japanese.EUCJP)(euc)
+}
+
+// Halfwidth katakana U+FF61 to U+FF9F are 0xa1 to 0xdf
+func encodeKatakana(r rune) ([]byte, bool) {
+	if r < 0xff61 || r > 0xff9f {
+		return nil, false
+	}
+	return []byte{byte(r - 0xff61 + 0xa1)}, true
+}
+
+// JIS X 0208 in G0, as EUC-JP with the high bits set
+func decodeJIS0208(b []byte) string {
+	euc := make([]byte, len(b))
+	for i, c := range b {
+		euc[i] = c | 0x80
+	}
+	return decoderFunc(japanese.EUCJP)(euc)
+}
+
+func encodeJIS0208(r rune) ([]byte, bool) {
+	euc, err := japanese.EUCJP.NewEncoder().Bytes([]byte(string(r)))
+	if err != nil || len(euc) != 2 || euc[0] < 0xa1 {
+		return nil, false
+	}
+	return []byte{euc[0] & 0x7f, euc[1] & 0x7f}, true
+}
+
+// JIS X 0212 in G0, as EUC-JP single shift 3 sequences
+func decodeJIS0212(b []byte) string {
+	euc := make([]byte, 0, len(b)*3/2+1)
+	for i := 0; i+1 < len(b); i += 2 {
+		euc = append(euc, 0x8f, b[i]|0x80, b[i+1]|0x80)
+	}
+	return decoderFunc(japanese.EUCJP)(euc)
+}
+
+func encodeJIS0212(r rune) ([]byte, bool) {
+	euc, err := japanese.EUCJP.NewEncoder().Bytes([]byte(string(r)))
+	if err != nil || len(euc) != 3 || euc[0] != 0x8f {
+		return nil, false
+	}
+	return []byte{euc[1] & 0x7f, euc[2] & 0x7f}, true
+}
@@ -0,0 +1,215 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
+	"github.com/JamesDarcy616/dicom/uid"
+)
+
+func TestTranscode(t *testing.T) {
+	ds := NewDataset()
+	ds.Put(testElement(t, tag.SpecificCharacterSet, "CS", "ISO_IR 100"))
+	ds.Put(testElement(t, tag.PatientName, "PN", "Müller^Jürgen"))
+	ds.Put(testElement(t, tag.PixelData, "OB", make([]byte, 1024)))
+	filename := testFile(t, ds, uid.ExplicitVRLittleEndian)
+
+	out, err := NewParserWithOptions(ParseOptions{LazyLoadSize: 256}).ParseFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Transcode(out, "ISO_IR 126"); !dcmerr.IsErrNotRepresentable(err) {
+		t.Errorf("Transcode to Greek: %v", err)
+	}
+	if err := Transcode(out, "ISO_IR 192"); err != nil {
+		t.Fatal(err)
+	}
+	if cs, _ := out.GetString(tag.SpecificCharacterSet); cs != "ISO_IR 192" {
+		t.Errorf("SpecificCharacterSet %q", cs)
+	}
+	pixels, _ := out.Get(tag.PixelData)
+	if loader, ok := pixels.Value.(Loader); !ok || loader.Loaded() {
+		t.Error("PixelData loaded by Transcode")
+	}
+}
+
+// PS3.5 H.3.1 example of a Japanese PN value using ISO 2022 IR 87
+const (
+	yamadaEncoded = "Yamada^Tarou=\x1b$B;3ED\x1b(B^\x1b$BB@O:\x1b(B=\x1b$B$d$^$@\x1b(B^\x1b$B$?$m$&\x1b(B"
+	yamada        = "Yamada^Tarou=山田^太郎=やまだ^たろう"
+)
+
+// An ExpLE dataset in ISO 2022 IR 87 with an undefined length SQ, the first
+// item overrides the character set with ISO_IR 100 and the second inherits it
+func charsetStream() []byte {
+	le := binary.LittleEndian
+	padded := func(s string) []byte {
+		if len(s)%2 != 0 {
+			s += " "
+		}
+		return []byte(s)
+	}
+	item := func(elems ...[]byte) []byte {
+		b := []byte{0xfe, 0xff, 0x00, 0xe0, 0xff, 0xff, 0xff, 0xff}
+		for _, elem := range elems {
+			b = append(b, elem...)
+		}
+		return append(b, 0xfe, 0xff, 0x0d, 0xe0, 0, 0, 0, 0)
+	}
+	var data []byte
+	data = append(data, explicitElement(le, tag.SpecificCharacterSet, "CS", padded("\\ISO 2022 IR 87"))...)
+	// SQ header with undefined length
+	data = append(data, 0x08, 0x00, 0x40, 0x11, 'S', 'Q', 0, 0, 0xff, 0xff, 0xff, 0xff)
+	data = append(data, item(
+		explicitElement(le, tag.SpecificCharacterSet, "CS", padded("ISO_IR 100")),
+		explicitElement(le, tag.PatientName, "PN", padded("M\xfcller^J\xfcrgen")))...)
+	data = append(data, item(explicitElement(le, tag.PatientName, "PN", padded(yamadaEncoded)))...)
+	data = append(data, 0xfe, 0xff, 0xdd, 0xe0, 0, 0, 0, 0)
+	data = append(data, explicitElement(le, tag.PatientName, "PN", padded(yamadaEncoded))...)
+	return data
+}
+
+func TestDecodeISO2022(t *testing.T) {
+	ds, err := NewParser().Parse(bytes.NewReader(charsetStream()), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := ds.GetPersonName(tag.PatientName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name.String() != yamada {
+		t.Errorf("PatientName %q, want %q", name, yamada)
+	}
+	if name.Ideographic.FamilyName != "山田" || name.Phonetic.GivenName != "たろう" {
+		t.Errorf("PatientName groups %+v", name)
+	}
+}
+
+func TestItemCharset(t *testing.T) {
+	want := []string{"Müller^Jürgen", yamada, yamada}
+	ds, err := NewParser().Parse(bytes.NewReader(charsetStream()), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := ds.GetSequence(tag.ReferencedImageSequence)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("%v items, %v", len(items), err)
+	}
+	var got []string
+	for _, item := range items {
+		name, _ := item.GetString(tag.PatientName)
+		got = append(got, name)
+	}
+	name, _ := ds.GetString(tag.PatientName)
+	got = append(got, name)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse: got %q, want %q", got, want)
+	}
+
+	// Walk descending into the sequence
+	var names []*Element
+	err = NewParser().Walk(bytes.NewReader(charsetStream()), true, func(path []uint32, elem *Element) (Action, error) {
+		switch elem.Tag {
+		case tag.ReferencedImageSequence:
+			return WalkDescend, nil
+		case tag.PatientName:
+			names = append(names, elem)
+		}
+		return WalkRead, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = got[:0]
+	for _, elem := range names {
+		got = append(got, elem.Value.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk: got %q, want %q", got, want)
+	}
+}
+
+func latin1File(t *testing.T) string {
+	ds := NewDataset()
+	ds.Put(testElement(t, tag.SpecificCharacterSet, "CS", "ISO_IR 100"))
+	ds.Put(testElement(t, tag.StudyDate, "DA", "20221014"))
+	ds.Put(testElement(t, tag.PatientName, "PN", "Müller^Jürgen"))
+	ds.Put(testElement(t, tag.PatientID, "LO", "ID1"))
+	return testFile(t, ds, uid.ExplicitVRLittleEndian)
+}
+
+func TestFilterKeepsCharset(t *testing.T) {
+	filename := latin1File(t)
+	for _, opts := range []ParseOptions{
+		{IncludeTags: []uint32{tag.PatientName}},
+		{ExcludeGroups: []GroupRange{{First: 0x0008, Last: 0x0008}}},
+		{ExcludeTags: []uint32{tag.SpecificCharacterSet}},
+	} {
+		ds, err := NewParserWithOptions(opts).ParseFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, err := ds.GetString(tag.PatientName)
+		if err != nil || name != "Müller^Jürgen" {
+			t.Errorf("%+v: PatientName %q, %v", opts, name, err)
+		}
+		if _, err := ds.Get(tag.SpecificCharacterSet); err == nil {
+			t.Errorf("%+v: SpecificCharacterSet not filtered", opts)
+		}
+	}
+}
+
+func TestWalkSkipKeepsCharset(t *testing.T) {
+	filename := latin1File(t)
+	var name *Element
+	err := NewParser().WalkFile(filename, func(path []uint32, elem *Element) (Action, error) {
+		if elem.Tag != tag.PatientName {
+			return WalkSkip, nil
+		}
+		// The value is read into elem after returning
+		name = elem
+		return WalkRead, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name == nil || name.Value.String() != "Müller^Jürgen" {
+		t.Errorf("PatientName %v", name)
+	}
+}
@@ -34,14 +34,18 @@ package dicom
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
 	"github.com/JamesDarcy616/dicom/vr"
 )
 
 type Dataset struct {
 	elems map[uint32]*Element
+	// Encoding of the item header if the Dataset is a parsed SQ item
+	source *SourceInfo
 }
 
 func NewDataset() *Dataset {
@@ -49,6 +53,42 @@ func NewDataset() *Dataset {
 	return &ds
 }
 
+// Frames of encapsulated PixelData, grouped using the ExtendedOffsetTable if
+// present, otherwise the Basic Offset Table and NumberOfFrames
+func (ds *Dataset) Frames() ([][]byte, error) {
+	elem, err := ds.Get(tag.PixelData)
+	if err != nil {
+		return nil, err
+	}
+	pixels, ok := elem.Value.Get().(*EncapsulatedPixelData)
+	if !ok {
+		return nil, dcmerr.Errorf(dcmerr.ErrNotConvertible, "PixelData is not encapsulated")
+	}
+	if eot, ok := ds.elems[tag.ExtendedOffsetTable]; ok {
+		eotLengths, err := ds.Get(tag.ExtendedOffsetTableLengths)
+		if err != nil {
+			return nil, err
+		}
+		offsets, ok := eot.Value.GetAll().([]uint64)
+		if !ok {
+			return nil, dcmerr.Errorf(dcmerr.ErrNotConvertible, "Cannot convert ExtendedOffsetTable to []uint64")
+		}
+		lengths, ok := eotLengths.Value.GetAll().([]uint64)
+		if !ok {
+			return nil, dcmerr.Errorf(dcmerr.ErrNotConvertible, "Cannot convert ExtendedOffsetTableLengths to []uint64")
+		}
+		return pixels.FramesExtended(offsets, lengths)
+	}
+	nFrames := 1
+	if str, err := ds.GetString(tag.NumberOfFrames); err == nil {
+		nFrames, err = strconv.Atoi(str)
+		if err != nil {
+			return nil, dcmerr.Errorf(dcmerr.ErrNotConvertible, "Cannot convert NumberOfFrames %v to int", str)
+		}
+	}
+	return pixels.Frames(nFrames)
+}
+
 func (ds *Dataset) Get(tag uint32) (*Element, error) {
 	elem, ok := ds.elems[tag]
 	if !ok {
@@ -57,17 +97,40 @@ func (ds *Dataset) Get(tag uint32) (*Element, error) {
 	return elem, nil
 }
 
+// The first value of a string element
 func (ds *Dataset) GetString(tag uint32) (string, error) {
-	elem, ok := ds.elems[tag]
-	if !ok {
-		return "", dcmerr.Errorf(dcmerr.ErrNotFound, "Element 0x%08x not found", tag)
+	elem, err := ds.loadedElement(tag)
+	if err != nil {
+		return "", err
+	}
+	if elem.Value.IsEmpty() {
+		return "", dcmerr.Errorf(dcmerr.ErrEmpty, "Element 0x%08x is empty", tag)
 	}
 	value := elem.Value.Get()
 	switch value := value.(type) {
 	case string:
 		return value, nil
 	default:
-		return "", dcmerr.Errorf(dcmerr.ErrNotFound, "Cannot convert element 0x%08x to string", tag)
+		return "", dcmerr.Errorf(dcmerr.ErrNotConvertible, "Cannot convert element 0x%08x to string", tag)
+	}
+}
+
+// All values of a string element, split on backslash except for LT, ST, UT
+// and UR
+func (ds *Dataset) GetStrings(tag uint32) ([]string, error) {
+	elem, err := ds.loadedElement(tag)
+	if err != nil {
+		return nil, err
+	}
+	if isUntypedEmpty(elem.Value) {
+		return []string{}, nil
+	}
+	value := elem.Value.GetAll()
+	switch value := value.(type) {
+	case []string:
+		return value, nil
+	default:
+		return nil, dcmerr.Errorf(dcmerr.ErrNotConvertible, "Cannot convert element 0x%08x to []string", tag)
 	}
 }
 
@@ -75,6 +138,32 @@ func (ds *Dataset) Iterator() DSIterator {
 	return newIterator(ds)
 }
 
+// Iterate over elements in the order they were read, elements without a
+// Source follow in tag order. The file meta comes first as offsets in a
+// deflated body restart from 0.
+func (ds *Dataset) SourceIterator() DSIterator {
+	iter := newIterator(ds).(*iterator)
+	sort.SliceStable(iter.keys, func(i, j int) bool {
+		a := ds.elems[iter.keys[i]].Source
+		b := ds.elems[iter.keys[j]].Source
+		if a == nil || b == nil {
+			return a != nil
+		}
+		metaA, metaB := iter.keys[i]>>16 == 0x0002, iter.keys[j]>>16 == 0x0002
+		if metaA != metaB {
+			return metaA
+		}
+		return a.Offset < b.Offset
+	})
+	return iter
+}
+
+// Encoding of the item header if the Dataset was parsed as an SQ item with
+// KeepSource, otherwise nil
+func (ds *Dataset) Source() *SourceInfo {
+	return ds.source
+}
+
 func (ds *Dataset) Put(elem *Element) {
 	if elem == nil {
 		return
@@ -87,10 +176,10 @@ func (ds *Dataset) PutString(tag uint32, vrStr, str string) error {
 		return dcmerr.Errorf(dcmerr.ErrNotConvertible,
 			"VR %v is not a string VR", vrStr)
 	}
-	value, err := NewValue(str)
-	if err != nil {
+	if err := validateNumberString(vrStr, str); err != nil {
 		return err
 	}
+	value := newStringValue(vrStr, str)
 	elem := NewElement(tag, vrStr, uint32(len(str)), value)
 	ds.elems[elem.Tag] = elem
 	return nil
@@ -0,0 +1,431 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
+)
+
+// The smallest unit present in a DA, TM or DT value
+type Precision int
+
+const (
+	// The full precision of the VR when formatting, seconds for TM and DT
+	PrecisionFull Precision = iota
+	PrecisionYear
+	PrecisionMonth
+	PrecisionDay
+	PrecisionHour
+	PrecisionMinute
+	PrecisionSecond
+	// FractionDigits digits of the seconds
+	PrecisionFraction
+)
+
+// A DA, TM or DT value. Time is in UTC unless HasOffset is true, TM values
+// are on 1 January of year 1.
+type DateTime struct {
+	Time           time.Time
+	Precision      Precision
+	FractionDigits int
+	// The value, or TimezoneOffsetFromUTC, gave the offset from UTC
+	HasOffset bool
+}
+
+// The first instant after the period covered by the precision of d
+func (d DateTime) End() time.Time {
+	switch d.Precision {
+	case PrecisionYear:
+		return d.Time.AddDate(1, 0, 0)
+	case PrecisionMonth:
+		return d.Time.AddDate(0, 1, 0)
+	case PrecisionDay:
+		return d.Time.AddDate(0, 0, 1)
+	case PrecisionHour:
+		return d.Time.Add(time.Hour)
+	case PrecisionMinute:
+		return d.Time.Add(time.Minute)
+	case PrecisionFraction:
+		unit := time.Second
+		for i := 0; i < d.FractionDigits; i++ {
+			unit /= 10
+		}
+		return d.Time.Add(unit)
+	}
+	return d.Time.Add(time.Second)
+}
+
+// A range query of DA, TM or DT values, Start or End is nil if open
+type DateTimeRange struct {
+	Start *DateTime
+	End   *DateTime
+}
+
+// True if t falls within the range, the end is inclusive to its precision
+func (r DateTimeRange) Contains(t time.Time) bool {
+	if r.Start != nil && t.Before(r.Start.Time) {
+		return false
+	}
+	if r.End != nil && !t.Before(r.End.End()) {
+		return false
+	}
+	return true
+}
+
+// Parse a DA value YYYYMMDD, or the ACR-NEMA form YYYY.MM.DD
+func ParseDate(s string) (DateTime, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 10 && s[4] == '.' && s[7] == '.' {
+		s = s[:4] + s[5:7] + s[8:]
+	}
+	if len(s) != 8 {
+		return DateTime{}, dcmerr.Errorf(dcmerr.ErrNotConvertible, "invalid DA %q", s)
+	}
+	t, precision, ok := parseDateDigits(s)
+	if !ok {
+		return DateTime{}, dcmerr.Errorf(dcmerr.ErrNotConvertible, "invalid DA %q", s)
+	}
+	return DateTime{Time: t, Precision: precision}, nil
+}
+
+// Parse a TM value HH[MM[SS[.F{1-6}]]], or the ACR-NEMA form HH:MM:SS.frac
+func ParseTime(s string) (DateTime, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ":", "")
+	dt, ok := parseTimeDigits(s, time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC))
+	if !ok {
+		return DateTime{}, dcmerr.Errorf(dcmerr.ErrNotConvertible, "invalid TM %q", s)
+	}
+	return dt, nil
+}
+
+// Parse a DT value YYYY[MM[DD[HH[MM[SS[.F{1-6}]]]]]][&ZZXX]
+func ParseDateTime(s string) (DateTime, error) {
+	s = strings.TrimSpace(s)
+	var loc *time.Location
+	if i := strings.LastIndexAny(s, "+-"); i >= 4 {
+		var ok bool
+		if loc, ok = parseOffset(s[i:]); !ok {
+			return DateTime{}, dcmerr.Errorf(dcmerr.ErrNotConvertible, "invalid DT %q", s)
+		}
+		s = s[:i]
+	}
+	datePart := s
+	if len(datePart) > 8 {
+		datePart = s[:8]
+	}
+	date, precision, ok := parseDateDigits(datePart)
+	if !ok {
+		return DateTime{}, dcmerr.Errorf(dcmerr.ErrNotConvertible, "invalid DT %q", s)
+	}
+	dt := DateTime{Time: date, Precision: precision}
+	if len(s) > 8 {
+		if dt, ok = parseTimeDigits(s[8:], date); !ok {
+			return DateTime{}, dcmerr.Errorf(dcmerr.ErrNotConvertible, "invalid DT %q", s)
+		}
+	}
+	if loc != nil {
+		dt.Time = inLocation(dt.Time, loc)
+		dt.HasOffset = true
+	}
+	return dt, nil
+}
+
+// Parse a range query of values of VR DA, TM or DT. A single value matches
+// the period covered by its precision.
+func ParseDateTimeRange(s string, vr string) (DateTimeRange, error) {
+	var parse func(string) (DateTime, error)
+	switch vr {
+	case "DA":
+		parse = ParseDate
+	case "TM":
+		parse = ParseTime
+	case "DT":
+		parse = ParseDateTime
+	default:
+		return DateTimeRange{}, dcmerr.Errorf(dcmerr.ErrNotConvertible, "VR %v is not DA, TM or DT", vr)
+	}
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "-") {
+		dt, err := parse(s)
+		if err != nil {
+			return DateTimeRange{}, err
+		}
+		return DateTimeRange{Start: &dt, End: &dt}, nil
+	}
+	// A single DT with a negative UTC offset
+	if vr == "DT" {
+		if dt, err := parse(s); err == nil {
+			return DateTimeRange{Start: &dt, End: &dt}, nil
+		}
+	}
+	// A DT may contain '-' in its UTC offset, use the first split where both
+	// sides are valid
+	for i := 0; i < len(s); i++ {
+		if s[i] != '-' {
+			continue
+		}
+		var r DateTimeRange
+		if start := strings.TrimSpace(s[:i]); start != "" {
+			dt, err := parse(start)
+			if err != nil {
+				continue
+			}
+			r.Start = &dt
+		}
+		if end := strings.TrimSpace(s[i+1:]); end != "" {
+			dt, err := parse(end)
+			if err != nil {
+				continue
+			}
+			r.End = &dt
+		}
+		if r.Start == nil && r.End == nil {
+			break
+		}
+		return r, nil
+	}
+	return DateTimeRange{}, dcmerr.Errorf(dcmerr.ErrNotConvertible, "invalid %v range %q", vr, s)
+}
+
+func (ds *Dataset) GetDate(tag uint32) (DateTime, error) {
+	str, err := ds.GetString(tag)
+	if err != nil {
+		return DateTime{}, err
+	}
+	dt, err := ParseDate(str)
+	if err != nil {
+		return DateTime{}, err
+	}
+	return ds.withTimezone(dt), nil
+}
+
+func (ds *Dataset) GetTime(tag uint32) (DateTime, error) {
+	str, err := ds.GetString(tag)
+	if err != nil {
+		return DateTime{}, err
+	}
+	dt, err := ParseTime(str)
+	if err != nil {
+		return DateTime{}, err
+	}
+	return ds.withTimezone(dt), nil
+}
+
+func (ds *Dataset) GetDateTime(tag uint32) (DateTime, error) {
+	str, err := ds.GetString(tag)
+	if err != nil {
+		return DateTime{}, err
+	}
+	dt, err := ParseDateTime(str)
+	if err != nil {
+		return DateTime{}, err
+	}
+	return ds.withTimezone(dt), nil
+}
+
+func (ds *Dataset) PutDate(tag uint32, dt DateTime) error {
+	return ds.PutString(tag, "DA", dt.Time.Format("20060102"))
+}
+
+func (ds *Dataset) PutTime(tag uint32, dt DateTime) error {
+	return ds.PutString(tag, "TM", formatTime(dt))
+}
+
+func (ds *Dataset) PutDateTime(tag uint32, dt DateTime) error {
+	var str string
+	switch dt.Precision {
+	case PrecisionYear:
+		str = dt.Time.Format("2006")
+	case PrecisionMonth:
+		str = dt.Time.Format("200601")
+	case PrecisionDay:
+		str = dt.Time.Format("20060102")
+	default:
+		str = dt.Time.Format("20060102") + formatTime(dt)
+	}
+	if dt.HasOffset {
+		str += dt.Time.Format("-0700")
+	}
+	return ds.PutString(tag, "DT", str)
+}
+
+// Apply TimezoneOffsetFromUTC to values without an offset
+func (ds *Dataset) withTimezone(dt DateTime) DateTime {
+	if dt.HasOffset {
+		return dt
+	}
+	str, err := ds.GetString(tag.TimezoneOffsetFromUTC)
+	if err != nil {
+		return dt
+	}
+	loc, ok := parseOffset(strings.TrimSpace(str))
+	if !ok {
+		return dt
+	}
+	dt.Time = inLocation(dt.Time, loc)
+	dt.HasOffset = true
+	return dt
+}
+
+// Digits of a DA or the date of a DT, YYYY[MM[DD]]
+func parseDateDigits(s string) (time.Time, Precision, bool) {
+	var fields [3]int
+	precision := PrecisionYear
+	switch len(s) {
+	case 4:
+	case 6:
+		precision = PrecisionMonth
+	case 8:
+		precision = PrecisionDay
+	default:
+		return time.Time{}, 0, false
+	}
+	fields[1], fields[2] = 1, 1
+	for i, n := range []int{4, 2, 2} {
+		if len(s) == 0 {
+			break
+		}
+		v, ok := atoi(s[:n])
+		if !ok {
+			return time.Time{}, 0, false
+		}
+		fields[i] = v
+		s = s[n:]
+	}
+	t := time.Date(fields[0], time.Month(fields[1]), fields[2], 0, 0, 0, 0, time.UTC)
+	// Reject values normalised by time.Date, such as 20220230
+	if t.Month() != time.Month(fields[1]) || t.Day() != fields[2] {
+		return time.Time{}, 0, false
+	}
+	return t, precision, true
+}
+
+// Digits of a TM or the time of a DT, HH[MM[SS[.F{1-6}]]] added to date
+func parseTimeDigits(s string, date time.Time) (DateTime, bool) {
+	frac := ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s, frac = s[:i], s[i+1:]
+		if len(s) != 6 || len(frac) == 0 || len(frac) > 6 {
+			return DateTime{}, false
+		}
+	}
+	var fields [3]int
+	precision := PrecisionHour
+	switch len(s) {
+	case 2:
+	case 4:
+		precision = PrecisionMinute
+	case 6:
+		precision = PrecisionSecond
+	default:
+		return DateTime{}, false
+	}
+	for i := 0; len(s) > 0; i++ {
+		v, ok := atoi(s[:2])
+		if !ok {
+			return DateTime{}, false
+		}
+		fields[i] = v
+		s = s[2:]
+	}
+	// 60 seconds allows for leap seconds
+	if fields[0] > 23 || fields[1] > 59 || fields[2] > 60 {
+		return DateTime{}, false
+	}
+	ns := 0
+	if frac != "" {
+		v, ok := atoi(frac + strings.Repeat("0", 9-len(frac)))
+		if !ok {
+			return DateTime{}, false
+		}
+		ns = v
+		precision = PrecisionFraction
+	}
+	t := time.Date(date.Year(), date.Month(), date.Day(), fields[0], fields[1], fields[2], ns, time.UTC)
+	return DateTime{Time: t, Precision: precision, FractionDigits: len(frac)}, true
+}
+
+// A UTC offset &ZZXX
+func parseOffset(s string) (*time.Location, bool) {
+	if len(s) != 5 || (s[0] != '+' && s[0] != '-') {
+		return nil, false
+	}
+	h, ok1 := atoi(s[1:3])
+	m, ok2 := atoi(s[3:5])
+	if !ok1 || !ok2 || h > 14 || m > 59 {
+		return nil, false
+	}
+	offset := h*3600 + m*60
+	if s[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone(s, offset), true
+}
+
+// The same wall clock time in loc
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// Only digits, strconv.Atoi allows a sign
+func atoi(s string) (int, bool) {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+	}
+	v, err := strconv.Atoi(s)
+	return v, err == nil
+}
+
+func formatTime(dt DateTime) string {
+	switch dt.Precision {
+	case PrecisionHour:
+		return dt.Time.Format("15")
+	case PrecisionMinute:
+		return dt.Time.Format("1504")
+	case PrecisionFraction:
+		digits := dt.FractionDigits
+		if digits < 1 || digits > 6 {
+			digits = 6
+		}
+		frac := fmt.Sprintf("%09d", dt.Time.Nanosecond())[:digits]
+		return dt.Time.Format("150405") + "." + frac
+	}
+	return dt.Time.Format("150405")
+}
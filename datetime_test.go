@@ -0,0 +1,308 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
+)
+
+func date(y int, m time.Month, d, h, min, s, ns int) time.Time {
+	return time.Date(y, m, d, h, min, s, ns, time.UTC)
+}
+
+func TestParseDateTimeValues(t *testing.T) {
+	plus1 := time.FixedZone("+0100", 3600)
+	minus5 := time.FixedZone("-0500", -5*3600)
+	for _, c := range []struct {
+		vr, s string
+		want  DateTime
+	}{
+		{"DA", "20220315", DateTime{Time: date(2022, 3, 15, 0, 0, 0, 0), Precision: PrecisionDay}},
+		{"DA", "2022.03.15 ", DateTime{Time: date(2022, 3, 15, 0, 0, 0, 0), Precision: PrecisionDay}},
+		{"TM", "13", DateTime{Time: date(1, 1, 1, 13, 0, 0, 0), Precision: PrecisionHour}},
+		{"TM", "1304", DateTime{Time: date(1, 1, 1, 13, 4, 0, 0), Precision: PrecisionMinute}},
+		{"TM", "130405", DateTime{Time: date(1, 1, 1, 13, 4, 5, 0), Precision: PrecisionSecond}},
+		{"TM", "130405.12", DateTime{Time: date(1, 1, 1, 13, 4, 5, 120000000), Precision: PrecisionFraction, FractionDigits: 2}},
+		{"TM", "13:04:05.5", DateTime{Time: date(1, 1, 1, 13, 4, 5, 500000000), Precision: PrecisionFraction, FractionDigits: 1}},
+		{"TM", "235960", DateTime{Time: date(1, 1, 2, 0, 0, 0, 0), Precision: PrecisionSecond}},
+		{"DT", "2022", DateTime{Time: date(2022, 1, 1, 0, 0, 0, 0), Precision: PrecisionYear}},
+		{"DT", "202203", DateTime{Time: date(2022, 3, 1, 0, 0, 0, 0), Precision: PrecisionMonth}},
+		{"DT", "2022031513", DateTime{Time: date(2022, 3, 15, 13, 0, 0, 0), Precision: PrecisionHour}},
+		{"DT", "20220315130405.123456+0100", DateTime{Time: time.Date(2022, 3, 15, 13, 4, 5, 123456000, plus1),
+			Precision: PrecisionFraction, FractionDigits: 6, HasOffset: true}},
+		{"DT", "2022-0500", DateTime{Time: time.Date(2022, 1, 1, 0, 0, 0, 0, minus5), Precision: PrecisionYear, HasOffset: true}},
+	} {
+		var dt DateTime
+		var err error
+		switch c.vr {
+		case "DA":
+			dt, err = ParseDate(c.s)
+		case "TM":
+			dt, err = ParseTime(c.s)
+		case "DT":
+			dt, err = ParseDateTime(c.s)
+		}
+		if err != nil {
+			t.Errorf("%v %q: %v", c.vr, c.s, err)
+			continue
+		}
+		if !dt.Time.Equal(c.want.Time) || dt.Precision != c.want.Precision ||
+			dt.FractionDigits != c.want.FractionDigits || dt.HasOffset != c.want.HasOffset {
+			t.Errorf("%v %q: %+v, want %+v", c.vr, c.s, dt, c.want)
+		}
+		_, offset := dt.Time.Zone()
+		if _, want := c.want.Time.Zone(); offset != want {
+			t.Errorf("%v %q: offset %v, want %v", c.vr, c.s, offset, want)
+		}
+	}
+}
+
+func TestParseDateTimeInvalid(t *testing.T) {
+	for _, c := range []struct{ vr, s string }{
+		{"DA", ""},
+		{"DA", "2022031"},
+		{"DA", "20220230"},
+		{"DA", "2022-03-15"},
+		{"DA", "2022031a"},
+		{"TM", "24"},
+		{"TM", "1360"},
+		{"TM", "123"},
+		{"TM", "130405."},
+		{"TM", "130405.1234567"},
+		{"TM", "1304.5"},
+		{"TM", "+1"},
+		{"DT", "202"},
+		{"DT", "202203151"},
+		{"DT", "20220315+01"},
+		{"DT", "20220315+1500"},
+		{"DT", "20221315"},
+	} {
+		var err error
+		switch c.vr {
+		case "DA":
+			_, err = ParseDate(c.s)
+		case "TM":
+			_, err = ParseTime(c.s)
+		case "DT":
+			_, err = ParseDateTime(c.s)
+		}
+		if !dcmerr.IsErrNotConvertible(err) {
+			t.Errorf("%v %q: %v", c.vr, c.s, err)
+		}
+	}
+}
+
+func TestDateTimeEnd(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		want time.Time
+	}{
+		{"2022", date(2023, 1, 1, 0, 0, 0, 0)},
+		{"202212", date(2023, 1, 1, 0, 0, 0, 0)},
+		{"20221231", date(2023, 1, 1, 0, 0, 0, 0)},
+		{"2022123123", date(2023, 1, 1, 0, 0, 0, 0)},
+		{"202212312359", date(2023, 1, 1, 0, 0, 0, 0)},
+		{"20221231235959", date(2023, 1, 1, 0, 0, 0, 0)},
+		{"20221231235959.9", date(2023, 1, 1, 0, 0, 0, 0)},
+		{"20221231235959.999", date(2023, 1, 1, 0, 0, 0, 0)},
+	} {
+		dt, err := ParseDateTime(c.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if end := dt.End(); !end.Equal(c.want) {
+			t.Errorf("%q: End %v, want %v", c.s, end, c.want)
+		}
+	}
+}
+
+func TestParseDateTimeRange(t *testing.T) {
+	for _, c := range []struct {
+		s, vr      string
+		start, end string
+	}{
+		{"20220101-20220131", "DA", "2022-01-01T00:00:00Z", "2022-01-31T00:00:00Z"},
+		{"-20220131", "DA", "", "2022-01-31T00:00:00Z"},
+		{"20220101-", "DA", "2022-01-01T00:00:00Z", ""},
+		{"20220315", "DA", "2022-03-15T00:00:00Z", "2022-03-15T00:00:00Z"},
+		{"1000-1200", "TM", "0001-01-01T10:00:00Z", "0001-01-01T12:00:00Z"},
+		{"20220315-0500", "DT", "2022-03-15T00:00:00-05:00", "2022-03-15T00:00:00-05:00"},
+		{"20220315-0500-20220316+0100", "DT", "2022-03-15T00:00:00-05:00", "2022-03-16T00:00:00+01:00"},
+		{"-20220316-0500", "DT", "", "2022-03-16T00:00:00-05:00"},
+		{"2022-", "DT", "2022-01-01T00:00:00Z", ""},
+	} {
+		r, err := ParseDateTimeRange(c.s, c.vr)
+		if err != nil {
+			t.Errorf("%q: %v", c.s, err)
+			continue
+		}
+		format := func(dt *DateTime) string {
+			if dt == nil {
+				return ""
+			}
+			return dt.Time.Format(time.RFC3339)
+		}
+		if start, end := format(r.Start), format(r.End); start != c.start || end != c.end {
+			t.Errorf("%q: %v to %v, want %v to %v", c.s, start, end, c.start, c.end)
+		}
+	}
+	for _, c := range []struct{ s, vr string }{
+		{"-", "DA"},
+		{"", "DA"},
+		{"20220101-2022013", "DA"},
+		{"x-20220131", "DA"},
+		{"20220101", "PN"},
+	} {
+		if _, err := ParseDateTimeRange(c.s, c.vr); !dcmerr.IsErrNotConvertible(err) {
+			t.Errorf("%q %v: %v", c.s, c.vr, err)
+		}
+	}
+
+	// The end is inclusive to its precision
+	r, _ := ParseDateTimeRange("20220101-202201", "DT")
+	for _, c := range []struct {
+		t    time.Time
+		want bool
+	}{
+		{date(2021, 12, 31, 23, 59, 59, 0), false},
+		{date(2022, 1, 1, 0, 0, 0, 0), true},
+		{date(2022, 1, 31, 23, 59, 59, 0), true},
+		{date(2022, 2, 1, 0, 0, 0, 0), false},
+	} {
+		if got := r.Contains(c.t); got != c.want {
+			t.Errorf("Contains %v = %v", c.t, got)
+		}
+	}
+	if open := (DateTimeRange{}); !open.Contains(date(1, 1, 1, 0, 0, 0, 0)) {
+		t.Error("open range")
+	}
+}
+
+func TestTimezoneOffsetFromUTC(t *testing.T) {
+	ds := NewDataset()
+	ds.PutString(tag.TimezoneOffsetFromUTC, "SH", "-0500")
+	ds.PutString(tag.StudyDate, "DA", "20220315")
+	ds.PutString(tag.StudyTime, "TM", "1304")
+	ds.PutString(tag.AcquisitionDateTime, "DT", "20220315130405")
+	ds.PutString(tag.FrameReferenceDateTime, "DT", "20220315130405+0100")
+
+	for _, c := range []struct {
+		get    func(uint32) (DateTime, error)
+		tag32  uint32
+		want   string
+		offset bool
+	}{
+		{ds.GetDate, tag.StudyDate, "2022-03-15T00:00:00-05:00", true},
+		{ds.GetTime, tag.StudyTime, "0001-01-01T13:04:00-05:00", true},
+		{ds.GetDateTime, tag.AcquisitionDateTime, "2022-03-15T13:04:05-05:00", true},
+		// The offset in the value takes precedence
+		{ds.GetDateTime, tag.FrameReferenceDateTime, "2022-03-15T13:04:05+01:00", true},
+	} {
+		dt, err := c.get(c.tag32)
+		if err != nil {
+			t.Errorf("%08x: %v", c.tag32, err)
+			continue
+		}
+		if got := dt.Time.Format(time.RFC3339); got != c.want || dt.HasOffset != c.offset {
+			t.Errorf("%08x: %v %v, want %v", c.tag32, got, dt.HasOffset, c.want)
+		}
+	}
+
+	// Without TimezoneOffsetFromUTC values are UTC
+	ds = NewDataset()
+	ds.PutString(tag.StudyDate, "DA", "20220315")
+	if dt, _ := ds.GetDate(tag.StudyDate); dt.HasOffset || dt.Time.Location() != time.UTC {
+		t.Errorf("StudyDate %v", dt.Time)
+	}
+	ds.PutString(tag.TimezoneOffsetFromUTC, "SH", "bad")
+	if dt, _ := ds.GetDate(tag.StudyDate); dt.HasOffset {
+		t.Errorf("invalid TimezoneOffsetFromUTC applied %v", dt.Time)
+	}
+}
+
+func TestPutDateTime(t *testing.T) {
+	plus1 := time.FixedZone("+0100", 3600)
+	when := time.Date(2022, 3, 15, 13, 4, 5, 120000000, time.UTC)
+	for _, c := range []struct {
+		put  func(*Dataset, DateTime) error
+		dt   DateTime
+		want string
+	}{
+		{func(ds *Dataset, dt DateTime) error { return ds.PutDate(tag.StudyDate, dt) },
+			DateTime{Time: when, Precision: PrecisionDay}, "20220315"},
+		{func(ds *Dataset, dt DateTime) error { return ds.PutTime(tag.StudyTime, dt) },
+			DateTime{Time: when, Precision: PrecisionHour}, "13"},
+		{func(ds *Dataset, dt DateTime) error { return ds.PutTime(tag.StudyTime, dt) },
+			DateTime{Time: when, Precision: PrecisionMinute}, "1304"},
+		{func(ds *Dataset, dt DateTime) error { return ds.PutTime(tag.StudyTime, dt) },
+			DateTime{Time: when}, "130405"},
+		{func(ds *Dataset, dt DateTime) error { return ds.PutTime(tag.StudyTime, dt) },
+			DateTime{Time: when, Precision: PrecisionFraction, FractionDigits: 3}, "130405.120"},
+		{func(ds *Dataset, dt DateTime) error { return ds.PutTime(tag.StudyTime, dt) },
+			DateTime{Time: when, Precision: PrecisionFraction}, "130405.120000"},
+		{func(ds *Dataset, dt DateTime) error { return ds.PutDateTime(tag.AcquisitionDateTime, dt) },
+			DateTime{Time: when, Precision: PrecisionYear}, "2022"},
+		{func(ds *Dataset, dt DateTime) error { return ds.PutDateTime(tag.AcquisitionDateTime, dt) },
+			DateTime{Time: when, Precision: PrecisionMonth}, "202203"},
+		{func(ds *Dataset, dt DateTime) error { return ds.PutDateTime(tag.AcquisitionDateTime, dt) },
+			DateTime{Time: when, Precision: PrecisionDay}, "20220315"},
+		{func(ds *Dataset, dt DateTime) error { return ds.PutDateTime(tag.AcquisitionDateTime, dt) },
+			DateTime{Time: when}, "20220315130405"},
+		{func(ds *Dataset, dt DateTime) error { return ds.PutDateTime(tag.AcquisitionDateTime, dt) },
+			DateTime{Time: when.In(plus1), Precision: PrecisionFraction, FractionDigits: 1, HasOffset: true},
+			"20220315140405.1+0100"},
+	} {
+		ds := NewDataset()
+		if err := c.put(ds, c.dt); err != nil {
+			t.Fatal(err)
+		}
+		iter := ds.Iterator()
+		iter.Next()
+		elem := iter.Value()
+		if got := elem.Value.String(); got != c.want {
+			t.Errorf("%08x: %q, want %q", elem.Tag, got, c.want)
+		}
+	}
+
+	// Round trip with the offset and precision
+	dt, _ := ParseDateTime("20220315140405.1+0100")
+	ds := NewDataset()
+	ds.PutDateTime(tag.AcquisitionDateTime, dt)
+	got, err := ds.GetDateTime(tag.AcquisitionDateTime)
+	if err != nil || !got.Time.Equal(dt.Time) || got.Precision != dt.Precision || !got.HasOffset {
+		t.Errorf("round trip %+v, %v", got, err)
+	}
+}
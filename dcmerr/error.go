@@ -50,6 +50,14 @@ const (
 	ErrIterInvalid
 	ErrUnsupported
 	ErrNotImplemented
+
+	ErrCancelled
+	ErrLengthLimit
+	ErrDepthLimit
+	ErrSizeLimit
+
+	ErrNotRepresentable
+	ErrEmpty
 )
 
 func IsErrNotFound(err error) bool {
@@ -124,6 +132,60 @@ func IsErrIterInvalid(err error) bool {
 	}
 }
 
+func IsErrCancelled(err error) bool {
+	switch err := err.(type) {
+	case DicomError:
+		return err.Code() == ErrCancelled
+	default:
+		return false
+	}
+}
+
+func IsErrLengthLimit(err error) bool {
+	switch err := err.(type) {
+	case DicomError:
+		return err.Code() == ErrLengthLimit
+	default:
+		return false
+	}
+}
+
+func IsErrDepthLimit(err error) bool {
+	switch err := err.(type) {
+	case DicomError:
+		return err.Code() == ErrDepthLimit
+	default:
+		return false
+	}
+}
+
+func IsErrSizeLimit(err error) bool {
+	switch err := err.(type) {
+	case DicomError:
+		return err.Code() == ErrSizeLimit
+	default:
+		return false
+	}
+}
+
+func IsErrNotRepresentable(err error) bool {
+	switch err := err.(type) {
+	case DicomError:
+		return err.Code() == ErrNotRepresentable
+	default:
+		return false
+	}
+}
+
+func IsErrEmpty(err error) bool {
+	switch err := err.(type) {
+	case DicomError:
+		return err.Code() == ErrEmpty
+	default:
+		return false
+	}
+}
+
 func NewErrEOF() DicomError {
 	return &dicomError{msg: "EOF", code: ErrEOF}
 }
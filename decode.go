@@ -0,0 +1,150 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// Scratch buffers larger than this are left to the garbage collector
+const maxScratchSize = 1 << 20
+
+var scratchPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+// Read n bytes into a buffer from the pool, return it with putScratch once
+// decoded. The whole value is read, decoders ignore trailing bytes that do
+// not make up a complete number. If lenient a truncated value is returned
+// with the error holding the bytes that were read.
+func readScratch(r Reader, n uint32, lenient bool) (*[]byte, error) {
+	buf := scratchPool.Get().(*[]byte)
+	if uint32(cap(*buf)) < n {
+		*buf = make([]byte, n)
+	}
+	*buf = (*buf)[:n]
+	start := r.BytesRead()
+	if err := r.ReadBytes(*buf); err != nil {
+		if read := r.BytesRead() - start; lenient && read > 0 {
+			*buf = (*buf)[:read]
+			return buf, err
+		}
+		putScratch(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+func putScratch(buf *[]byte) {
+	if cap(*buf) > maxScratchSize {
+		return
+	}
+	scratchPool.Put(buf)
+}
+
+func decodeAttributeTags(order binary.ByteOrder, b []byte) []AttributeTag {
+	data := make([]AttributeTag, len(b)/4)
+	for i := range data {
+		g := order.Uint16(b[i*4:])
+		e := order.Uint16(b[i*4+2:])
+		data[i] = AttributeTag(uint32(g)<<16 | uint32(e))
+	}
+	return data
+}
+
+func decodeFloat32s(order binary.ByteOrder, b []byte) []float32 {
+	data := make([]float32, len(b)/4)
+	for i := range data {
+		data[i] = math.Float32frombits(order.Uint32(b[i*4:]))
+	}
+	return data
+}
+
+func decodeFloat64s(order binary.ByteOrder, b []byte) []float64 {
+	data := make([]float64, len(b)/8)
+	for i := range data {
+		data[i] = math.Float64frombits(order.Uint64(b[i*8:]))
+	}
+	return data
+}
+
+func decodeInt16s(order binary.ByteOrder, b []byte) []int16 {
+	data := make([]int16, len(b)/2)
+	for i := range data {
+		data[i] = int16(order.Uint16(b[i*2:]))
+	}
+	return data
+}
+
+func decodeInt32s(order binary.ByteOrder, b []byte) []int32 {
+	data := make([]int32, len(b)/4)
+	for i := range data {
+		data[i] = int32(order.Uint32(b[i*4:]))
+	}
+	return data
+}
+
+func decodeInt64s(order binary.ByteOrder, b []byte) []int64 {
+	data := make([]int64, len(b)/8)
+	for i := range data {
+		data[i] = int64(order.Uint64(b[i*8:]))
+	}
+	return data
+}
+
+func decodeUint16s(order binary.ByteOrder, b []byte) []uint16 {
+	data := make([]uint16, len(b)/2)
+	for i := range data {
+		data[i] = order.Uint16(b[i*2:])
+	}
+	return data
+}
+
+func decodeUint32s(order binary.ByteOrder, b []byte) []uint32 {
+	data := make([]uint32, len(b)/4)
+	for i := range data {
+		data[i] = order.Uint32(b[i*4:])
+	}
+	return data
+}
+
+func decodeUint64s(order binary.ByteOrder, b []byte) []uint64 {
+	data := make([]uint64, len(b)/8)
+	for i := range data {
+		data[i] = order.Uint64(b[i*8:])
+	}
+	return data
+}
@@ -0,0 +1,170 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/tag"
+)
+
+// Encode an explicit VR element with a 16 bit VL
+func explicitElement(order binary.ByteOrder, tag32 uint32, vr string, value []byte) []byte {
+	b := make([]byte, 8, 8+len(value))
+	order.PutUint16(b, uint16(tag32>>16))
+	order.PutUint16(b[2:], uint16(tag32))
+	copy(b[4:], vr)
+	order.PutUint16(b[6:], uint16(len(value)))
+	return append(b, value...)
+}
+
+func TestDecodeNumeric(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		us := make([]byte, 7)
+		order.PutUint16(us, 1)
+		order.PutUint16(us[2:], 65535)
+		order.PutUint16(us[4:], 512)
+		ss := make([]byte, 4)
+		order.PutUint16(ss, uint16(0xfffd))
+		order.PutUint16(ss[2:], 4)
+		ul := make([]byte, 10)
+		order.PutUint32(ul, 7)
+		order.PutUint32(ul[4:], math.MaxUint32)
+		fl := make([]byte, 8)
+		order.PutUint32(fl, math.Float32bits(1.5))
+		order.PutUint32(fl[4:], math.Float32bits(-0.25))
+		fd := make([]byte, 9)
+		order.PutUint64(fd, math.Float64bits(math.Pi))
+		cases := []struct {
+			tag32 uint32
+			vr    string
+			value []byte
+			want  interface{}
+		}{
+			// Odd lengths leave a partial number which is skipped
+			{tag.Rows, "US", us, []uint16{1, 65535, 512}},
+			{tag.SmallestImagePixelValue, "SS", ss, []int16{-3, 4}},
+			{tag.SimpleFrameList, "UL", ul, []uint32{7, math.MaxUint32}},
+			{tag.RecommendedDisplayFrameRateInFloat, "FL", fl, []float32{1.5, -0.25}},
+			{tag.TimeRange, "FD", fd, []float64{math.Pi}},
+			{tag.Columns, "US", nil, []uint16{}},
+		}
+		var data []byte
+		for _, c := range cases {
+			data = append(data, explicitElement(order, c.tag32, c.vr, c.value)...)
+		}
+		p := NewParser()
+		r := NewReader(bytes.NewReader(data), order, true)
+		for _, c := range cases {
+			elem, err := p.readElement(r)
+			if err != nil {
+				t.Fatalf("%v %v: %v", order, c.vr, err)
+			}
+			if elem.Tag != c.tag32 || !reflect.DeepEqual(elem.Value.GetAll(), c.want) {
+				t.Errorf("%v %08x %v: got %v, want %v", order, elem.Tag, c.vr, elem.Value.GetAll(), c.want)
+			}
+		}
+		if r.BytesRead() != uint64(len(data)) {
+			t.Errorf("%v: read %v bytes of %v", order, r.BytesRead(), len(data))
+		}
+	}
+}
+
+func numericDataset(t testing.TB) *Dataset {
+	ds := NewDataset()
+	floats := make([]float32, 1<<16)
+	for i := range floats {
+		floats[i] = float32(i) / 3
+	}
+	ds.Put(testElement(t, tag.FloatPixelData, "OF", floats))
+	ds.Put(testElement(t, tag.LongPrimitivePointIndexList, "OL", make([]uint32, 1<<16)))
+	ds.Put(testElement(t, tag.SmallestImagePixelValue, "SS", []int16{-3, 4}))
+	ds.Put(testElement(t, tag.TimeRange, "FD", []float64{1.5, -2.25}))
+	return ds
+}
+
+func BenchmarkParseNumeric(b *testing.B) {
+	var buf bytes.Buffer
+	if err := Write(&buf, numericDataset(b), true); err != nil {
+		b.Fatal(err)
+	}
+	data := buf.Bytes()
+	p := NewParser()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Parse(bytes.NewReader(data), true); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Decoding 64k floats in bulk against the earlier binary.Read per value
+func BenchmarkDecodeFloat32(b *testing.B) {
+	data := make([]byte, 4<<16)
+	for i := 0; i < len(data); i += 4 {
+		binary.LittleEndian.PutUint32(data[i:], math.Float32bits(float32(i)/3))
+	}
+	vl := uint32(len(data))
+	b.Run("bulk", func(b *testing.B) {
+		p := NewParser()
+		b.ReportAllocs()
+		b.SetBytes(int64(vl))
+		for i := 0; i < b.N; i++ {
+			r := NewReader(bytes.NewReader(data), binary.LittleEndian, true)
+			if _, err := p.readFloat32Value(r, vl); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("per value", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(vl))
+		for i := 0; i < b.N; i++ {
+			r := NewReader(bytes.NewReader(data), binary.LittleEndian, true)
+			values := make([]float32, vl/4)
+			for j := range values {
+				if err := binary.Read(r, r.ByteOrder(), &values[j]); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if _, err := NewValue(values); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
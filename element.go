@@ -43,6 +43,22 @@ type Element struct {
 	VR    string
 	VL    uint32
 	Value Value
+	// Where and how the element was encoded, set when parsed with KeepSource
+	Source *SourceInfo
+}
+
+// The encoding of an element or SQ item as read from its source
+type SourceInfo struct {
+	// Offset of the tag from the start of the stream. In a deflated file
+	// offsets in the body are from the start of the inflated body, not the
+	// file.
+	Offset uint64
+	// Length of the tag, VR and VL
+	HeaderLength uint32
+	// VR as encoded, empty if implicit. May differ from the element VR if
+	// the VR was recovered or retyped.
+	VR              string
+	UndefinedLength bool
 }
 
 func NewElement(tag uint32, vr string, vl uint32, value Value) *Element {
@@ -58,8 +74,7 @@ func (e *Element) String() string {
 	var sb strings.Builder
 	sb.Grow(200)
 	sb.WriteString(fmt.Sprintf("(%08x) %v #", e.Tag, e.VR))
-	if e.VR == "SQ" {
-		sq := e.Value.(*sqValue)
+	if sq, ok := e.Value.(*sqValue); ok {
 		n := len(sq.value)
 		switch n {
 		case 0:
@@ -80,6 +95,14 @@ func (e *Element) formatValue(max int) string {
 	var sb strings.Builder
 	sb.Grow(64)
 
+	if lazy, ok := e.Value.(*lazyValue); ok {
+		return lazy.format()
+	}
+	// Empty values of every type print as nothing
+	if e.Value == nil || e.Value.IsEmpty() {
+		return ""
+	}
+
 	switch value := e.Value.(type) {
 	case *stringValue:
 		sb.WriteString(value.String())
@@ -116,6 +139,28 @@ func (e *Element) formatValue(max int) string {
 				sb.WriteString("\\")
 			}
 		}
+	case *int64Value:
+		last := len(value.value) - 1
+		for i, v := range value.value {
+			sb.WriteString(fmt.Sprint(v))
+			if sb.Len() > 64 {
+				break
+			}
+			if i < last {
+				sb.WriteString("\\")
+			}
+		}
+	case *tagValue:
+		last := len(value.value) - 1
+		for i, v := range value.value {
+			sb.WriteString(fmt.Sprint(v))
+			if sb.Len() > 64 {
+				break
+			}
+			if i < last {
+				sb.WriteString("\\")
+			}
+		}
 	case *uint32Value:
 		last := len(value.value) - 1
 		for i, v := range value.value {
@@ -127,6 +172,19 @@ func (e *Element) formatValue(max int) string {
 				sb.WriteString("\\")
 			}
 		}
+	case *uint64Value:
+		last := len(value.value) - 1
+		for i, v := range value.value {
+			sb.WriteString(fmt.Sprint(v))
+			if sb.Len() > 64 {
+				break
+			}
+			if i < last {
+				sb.WriteString("\\")
+			}
+		}
+	case *encapsulatedValue:
+		sb.WriteString(value.String())
 	case *bytesValue:
 		last := len(value.value) - 1
 		for i, v := range value.value {
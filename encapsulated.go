@@ -0,0 +1,138 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"github.com/JamesDarcy616/dicom/dcmerr"
+)
+
+// Size of the SQItem tag and length preceding each fragment
+const fragmentHeaderLength = 8
+
+// Undefined length pixel data in an encapsulated (compressed) TransferSyntax
+type EncapsulatedPixelData struct {
+	// Offsets of the first fragment of each frame, may be empty
+	BasicOffsetTable []uint32
+	Fragments        [][]byte
+}
+
+// Group the fragments into frames using the Basic Offset Table if present,
+// otherwise assume a single frame or one fragment per frame
+func (e *EncapsulatedPixelData) Frames(nFrames int) ([][]byte, error) {
+	if len(e.BasicOffsetTable) > 0 {
+		return e.framesFromOffsets(e.BasicOffsetTable)
+	}
+	switch {
+	case nFrames <= 1:
+		return [][]byte{e.concat(e.Fragments)}, nil
+	case nFrames == len(e.Fragments):
+		return e.Fragments, nil
+	}
+	return nil, dcmerr.Errorf(dcmerr.ErrUnsupported,
+		"cannot group %v fragments into %v frames without an offset table", len(e.Fragments), nFrames)
+}
+
+// Group the fragments into frames using ExtendedOffsetTable and
+// ExtendedOffsetTableLengths, each frame is contained within one fragment
+func (e *EncapsulatedPixelData) FramesExtended(offsets, lengths []uint64) ([][]byte, error) {
+	if len(offsets) != len(lengths) {
+		return nil, dcmerr.Errorf(dcmerr.ErrNotConvertible,
+			"extended offset table has %v offsets but %v lengths", len(offsets), len(lengths))
+	}
+	positions := e.fragmentOffsets()
+	frames := make([][]byte, len(offsets))
+	idx := 0
+	for i, offset := range offsets {
+		for idx < len(positions) && positions[idx] < offset {
+			idx++
+		}
+		if idx == len(positions) || positions[idx] != offset {
+			return nil, dcmerr.Errorf(dcmerr.ErrNotFound,
+				"no fragment at extended offset %v for frame %v", offset, i)
+		}
+		frag := e.Fragments[idx]
+		if lengths[i] > uint64(len(frag)) {
+			return nil, dcmerr.Errorf(dcmerr.ErrNotConvertible,
+				"frame %v length %v exceeds fragment length %v", i, lengths[i], len(frag))
+		}
+		frames[i] = frag[:lengths[i]]
+	}
+	return frames, nil
+}
+
+func (e *EncapsulatedPixelData) concat(frags [][]byte) []byte {
+	if len(frags) == 1 {
+		return frags[0]
+	}
+	n := 0
+	for _, frag := range frags {
+		n += len(frag)
+	}
+	frame := make([]byte, 0, n)
+	for _, frag := range frags {
+		frame = append(frame, frag...)
+	}
+	return frame
+}
+
+// Offset of each fragment item from the first fragment item after the Basic
+// Offset Table, as used by both offset tables
+func (e *EncapsulatedPixelData) fragmentOffsets() []uint64 {
+	positions := make([]uint64, len(e.Fragments))
+	var pos uint64
+	for i, frag := range e.Fragments {
+		positions[i] = pos
+		pos += fragmentHeaderLength + uint64(len(frag))
+	}
+	return positions
+}
+
+func (e *EncapsulatedPixelData) framesFromOffsets(offsets []uint32) ([][]byte, error) {
+	positions := e.fragmentOffsets()
+	frames := make([][]byte, len(offsets))
+	idx := 0
+	for i, offset := range offsets {
+		if idx == len(positions) || positions[idx] != uint64(offset) {
+			return nil, dcmerr.Errorf(dcmerr.ErrNotFound,
+				"no fragment at offset %v for frame %v", offset, i)
+		}
+		first := idx
+		// Frame runs to the next offset or the last fragment
+		for idx++; idx < len(positions); idx++ {
+			if i+1 < len(offsets) && positions[idx] >= uint64(offsets[i+1]) {
+				break
+			}
+		}
+		frames[i] = e.concat(e.Fragments[first:idx])
+	}
+	return frames, nil
+}
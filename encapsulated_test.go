@@ -0,0 +1,164 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
+	"github.com/JamesDarcy616/dicom/uid"
+)
+
+var fragments = [][]byte{{1, 2, 3, 4}, {5, 6}, {7, 8, 9, 10}}
+
+func encapsulatedDataset(t *testing.T, bot []uint32, nFrames string) *Dataset {
+	t.Helper()
+	ds := NewDataset()
+	ds.Put(testElement(t, tag.PixelData, "OB", &EncapsulatedPixelData{BasicOffsetTable: bot, Fragments: fragments}))
+	if nFrames != "" {
+		ds.Put(testElement(t, tag.NumberOfFrames, "IS", nFrames))
+	}
+	return ds
+}
+
+func TestFrames(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		ds   func(t *testing.T) *Dataset
+		want [][]byte
+	}{
+		{
+			name: "single frame",
+			ds:   func(t *testing.T) *Dataset { return encapsulatedDataset(t, nil, "") },
+			want: [][]byte{{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		},
+		{
+			name: "one fragment per frame",
+			ds:   func(t *testing.T) *Dataset { return encapsulatedDataset(t, nil, "3") },
+			want: fragments,
+		},
+		{
+			// The first frame is two fragments, each with an 8 byte header
+			name: "basic offset table",
+			ds:   func(t *testing.T) *Dataset { return encapsulatedDataset(t, []uint32{0, 22}, "2") },
+			want: [][]byte{{1, 2, 3, 4, 5, 6}, {7, 8, 9, 10}},
+		},
+		{
+			// Frames within the first and third fragments, ignoring the BOT
+			name: "extended offset table",
+			ds: func(t *testing.T) *Dataset {
+				ds := encapsulatedDataset(t, []uint32{0}, "2")
+				ds.PutUint64s(tag.ExtendedOffsetTable, "OV", 0, 22)
+				ds.PutUint64s(tag.ExtendedOffsetTableLengths, "OV", 3, 4)
+				return ds
+			},
+			want: [][]byte{{1, 2, 3}, {7, 8, 9, 10}},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			frames, err := c.ds(t).Frames()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(frames, c.want) {
+				t.Errorf("frames %v, want %v", frames, c.want)
+			}
+		})
+	}
+}
+
+func TestFramesErrors(t *testing.T) {
+	// Fragments can't be grouped without an offset table
+	ds := encapsulatedDataset(t, nil, "2")
+	if _, err := ds.Frames(); err == nil {
+		t.Error("2 frames from 3 fragments")
+	}
+	ds = encapsulatedDataset(t, []uint32{0, 10}, "2")
+	if _, err := ds.Frames(); !dcmerr.IsErrNotFound(err) {
+		t.Errorf("BOT offset between fragments: %v", err)
+	}
+	ds = encapsulatedDataset(t, nil, "2")
+	ds.PutUint64s(tag.ExtendedOffsetTable, "OV", 0, 12)
+	ds.PutUint64s(tag.ExtendedOffsetTableLengths, "OV", 4, 3)
+	if _, err := ds.Frames(); !dcmerr.IsErrNotConvertible(err) {
+		t.Errorf("EOT length beyond fragment: %v", err)
+	}
+	ds = NewDataset()
+	ds.Put(testElement(t, tag.PixelData, "OB", []byte{1, 2}))
+	if _, err := ds.Frames(); !dcmerr.IsErrNotConvertible(err) {
+		t.Errorf("native PixelData: %v", err)
+	}
+}
+
+func TestWriteEncapsulated(t *testing.T) {
+	ds := encapsulatedDataset(t, []uint32{0, 22}, "2")
+	filename := testFile(t, ds, uid.JPEGBaseline8Bit)
+	out, err := NewParser().ParseFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elem, err := out.Get(tag.PixelData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elem.VL != UndefinedLength || elem.Value.Len() != len(fragments) {
+		t.Errorf("VL %08x, %v fragments", elem.VL, elem.Value.Len())
+	}
+	pixels, ok := elem.Value.Get().(*EncapsulatedPixelData)
+	if !ok {
+		t.Fatalf("PixelData %T", elem.Value.Get())
+	}
+	if !reflect.DeepEqual(pixels.BasicOffsetTable, []uint32{0, 22}) || !reflect.DeepEqual(pixels.Fragments, fragments) {
+		t.Errorf("BOT %v, fragments %v", pixels.BasicOffsetTable, pixels.Fragments)
+	}
+	frames, err := out.Frames()
+	if err != nil || len(frames) != 2 {
+		t.Errorf("%v frames, %v", len(frames), err)
+	}
+
+	// An empty Basic Offset Table is written as an empty item
+	ds = encapsulatedDataset(t, nil, "")
+	out, err = NewParser().ParseFile(testFile(t, ds, uid.JPEGBaseline8Bit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	elem, _ = out.Get(tag.PixelData)
+	pixels, _ = elem.Value.Get().(*EncapsulatedPixelData)
+	if pixels == nil || len(pixels.BasicOffsetTable) != 0 || len(pixels.Fragments) != 3 {
+		t.Errorf("PixelData %v", elem.Value)
+	}
+	if n := (&encapsulatedValue{}).Len(); n != 0 {
+		t.Errorf("empty Len %v", n)
+	}
+}
@@ -0,0 +1,532 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
+)
+
+type sqLengthMode int
+
+const (
+	// Follow the VL of each SQ element, UndefinedLength or defined
+	sqLengthAsElement sqLengthMode = iota
+	sqLengthDefined
+	sqLengthUndefined
+)
+
+type WriteOption func(*writeOptions)
+
+type writeOptions struct {
+	sqLength sqLengthMode
+}
+
+// Write all sequences and items with explicit lengths
+func WithDefinedLengthSequences() WriteOption {
+	return func(o *writeOptions) {
+		o.sqLength = sqLengthDefined
+	}
+}
+
+// Write all sequences and items with UndefinedLength and delimiters
+func WithUndefinedLengthSequences() WriteOption {
+	return func(o *writeOptions) {
+		o.sqLength = sqLengthUndefined
+	}
+}
+
+// Write the dataset without preamble or file meta in ExpLE or ImpLE, the
+// counterpart of Parser.Parse
+func Write(w io.Writer, ds *Dataset, explicit bool, opts ...WriteOption) error {
+	enc := newEncoder(opts)
+	writer := NewWriter(w, binary.LittleEndian, explicit)
+	if err := enc.writeDataset(writer, ds); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// Write the dataset as a DICOM Part 10 file, the counterpart of Parser.ParseFile
+func WriteFile(filename string, ds *Dataset, opts ...WriteOption) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	enc := newEncoder(opts)
+	if err := enc.writeFile(file, ds); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+type encoder struct {
+	opts writeOptions
+	// From SpecificCharacterSet of the dataset being written
+	charset *charset
+}
+
+func newEncoder(opts []WriteOption) *encoder {
+	enc := encoder{}
+	for _, opt := range opts {
+		opt(&enc.opts)
+	}
+	return &enc
+}
+
+func (e *encoder) encodeDataset(order binary.ByteOrder, explicit bool, ds *Dataset) ([]byte, error) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, order, explicit)
+	if err := e.writeDataset(w, ds); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (e *encoder) encodeValue(order binary.ByteOrder, vr string, value Value) ([]byte, error) {
+	switch value := value.(type) {
+	case *emptyValue:
+		return nil, nil
+	case *stringValue:
+		data := []byte(value.value)
+		if e.charset != nil && isTextVR(vr) {
+			var err error
+			if data, err = e.charset.encode(value.value); err != nil {
+				return nil, err
+			}
+		}
+		// Values must have even length, UI is padded with NULL and other strings with space
+		if len(data)%2 != 0 {
+			if vr == "UI" {
+				data = append(data, 0)
+			} else {
+				data = append(data, ' ')
+			}
+		}
+		return data, nil
+	case *bytesValue:
+		if len(value.value)%2 != 0 {
+			data := make([]byte, len(value.value), len(value.value)+1)
+			copy(data, value.value)
+			return append(data, 0), nil
+		}
+		return value.value, nil
+	case *float32Value:
+		return e.encodeNumeric(order, value.value)
+	case *float64Value:
+		return e.encodeNumeric(order, value.value)
+	case *int16Value:
+		return e.encodeNumeric(order, value.value)
+	case *int32Value:
+		return e.encodeNumeric(order, value.value)
+	case *int64Value:
+		return e.encodeNumeric(order, value.value)
+	case *tagValue:
+		// Group and element are written as separate 16 bit values
+		pairs := make([]uint16, 0, 2*len(value.value))
+		for _, t := range value.value {
+			pairs = append(pairs, uint16(t>>16), uint16(t))
+		}
+		return e.encodeNumeric(order, pairs)
+	case *uint16Value:
+		return e.encodeNumeric(order, value.value)
+	case *uint32Value:
+		return e.encodeNumeric(order, value.value)
+	case *uint64Value:
+		return e.encodeNumeric(order, value.value)
+	default:
+		return nil, dcmerr.Errorf(dcmerr.ErrUnsupported, "unknown or unsupported value type: %T", value)
+	}
+}
+
+func (e *encoder) encodeNumeric(order binary.ByteOrder, data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, order, data); err != nil {
+		return nil, dcmerr.Errorf(dcmerr.ErrIO, "error encoding value - %v", err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+// Map the VR of an element to the VR to be written in an explicit VR stream,
+// resolving the ambiguous VRs from dcmtk.dic using the type of the value
+func (e *encoder) explicitVR(elem *Element) string {
+	switch elem.VR {
+	case "xs":
+		if _, ok := elem.Value.(*int16Value); ok {
+			return "SS"
+		}
+		return "US"
+	case "ox", "px":
+		if _, ok := elem.Value.(*int16Value); ok {
+			return "OW"
+		}
+		return "OB"
+	case "lt":
+		return "OW"
+	case "up":
+		return "UL"
+	case "na", "":
+		return "UN"
+	}
+	return elem.VR
+}
+
+func (e *encoder) isUndefinedLength(elem *Element) bool {
+	switch e.opts.sqLength {
+	case sqLengthDefined:
+		return false
+	case sqLengthUndefined:
+		return true
+	}
+	return elem.VL == UndefinedLength
+}
+
+func (e *encoder) setXferSyntax(w Writer, tsuid string) {
+	order, explicit := xferSyntaxEncoding(tsuid)
+	w.SetByteOrder(order)
+	w.SetExplicit(explicit)
+}
+
+// Write the elements after the file meta in the encoding of the TransferSyntax
+func (e *encoder) writeBody(w Writer, ds *Dataset, tsuid string) error {
+	e.setXferSyntax(w, tsuid)
+	iter := ds.Iterator()
+	for iter.Next() {
+		elem := iter.Value()
+		if elem.Tag>>16 == 0x0002 {
+			continue
+		}
+		if err := e.writeElement(w, elem); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+func (e *encoder) writeDataset(w Writer, ds *Dataset) error {
+	// Items inherit the character set unless they specify their own
+	parent := e.charset
+	defer func() { e.charset = parent }()
+	iter := ds.Iterator()
+	for iter.Next() {
+		if err := e.writeElement(w, iter.Value()); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+func (e *encoder) writeElement(w Writer, elem *Element) error {
+	value, err := resolveValue(elem.Value)
+	if err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case *sqValue:
+		if elem.VR == "UN" {
+			return e.writeUNSequence(w, elem, value)
+		}
+		return e.writeSequence(w, elem, value)
+	case *encapsulatedValue:
+		return e.writeEncapsulated(w, elem, value.value)
+	}
+	vr := e.explicitVR(elem)
+	data, err := e.encodeValue(w.ByteOrder(), vr, value)
+	if err != nil {
+		code := dcmerr.ErrIO
+		if dcmerr.IsErrNotRepresentable(err) {
+			code = dcmerr.ErrNotRepresentable
+		}
+		return dcmerr.Errorf(code,
+			"error encoding element 0x%08x - %v", elem.Tag, err.Error())
+	}
+	if err := e.writeElementHeader(w, elem.Tag, vr, uint32(len(data))); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return dcmerr.Errorf(dcmerr.ErrIO,
+			"error near byte %v (%08x) - %v", w.BytesWritten(), w.BytesWritten(), err.Error())
+	}
+	if elem.Tag == tag.SpecificCharacterSet {
+		// Text is written as is if the character set is not recognised
+		e.charset, _ = newCharset(value.String())
+	}
+	return nil
+}
+
+func (e *encoder) writeElementHeader(w Writer, tag32 uint32, vr string, vl uint32) error {
+	if err := e.writeTag(w, tag32); err != nil {
+		return err
+	}
+	if !w.IsExplicit() {
+		return w.WriteUint32(vl)
+	}
+	if err := w.WriteString(vr); err != nil {
+		return err
+	}
+	if useShortVL(vr) {
+		if vl > 0xffff {
+			return dcmerr.Errorf(dcmerr.ErrUnsupported,
+				"length %v too long for VR %v in element 0x%08x", vl, vr, tag32)
+		}
+		return w.WriteUint16(uint16(vl))
+	}
+	// Long VRs have 2 reserved bytes before a 32 bit length
+	if err := w.WriteUint16(0); err != nil {
+		return err
+	}
+	return w.WriteUint32(vl)
+}
+
+// Write pixel data as undefined length with the Basic Offset Table as the
+// first item followed by the fragments
+func (e *encoder) writeEncapsulated(w Writer, elem *Element, pixels *EncapsulatedPixelData) error {
+	if err := e.writeElementHeader(w, elem.Tag, e.explicitVR(elem), UndefinedLength); err != nil {
+		return err
+	}
+	offsets, err := e.encodeNumeric(w.ByteOrder(), pixels.BasicOffsetTable)
+	if err != nil {
+		return err
+	}
+	if err := e.writeFragment(w, offsets); err != nil {
+		return err
+	}
+	for _, frag := range pixels.Fragments {
+		if err := e.writeFragment(w, frag); err != nil {
+			return err
+		}
+	}
+	return e.writeMarker(w, SQDelim, 0)
+}
+
+func (e *encoder) writeFile(out io.Writer, ds *Dataset) error {
+	tsuid, err := ds.GetString(tag.TransferSyntaxUID)
+	if err != nil {
+		return err
+	}
+	// File meta is always ExpLE
+	w := NewWriter(out, binary.LittleEndian, true)
+	if err := e.writeHeader(w); err != nil {
+		return err
+	}
+	if err := e.writeFileMeta(w, ds); err != nil {
+		return err
+	}
+	if !isDeflated(tsuid) {
+		if err := e.writeBody(w, ds, tsuid); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	// Deflated body is compressed after the file meta into the same output
+	fw, err := flate.NewWriter(w, flate.DefaultCompression)
+	if err != nil {
+		return dcmerr.Errorf(dcmerr.ErrIO, "error creating deflate writer - %v", err.Error())
+	}
+	body := NewWriter(fw, binary.LittleEndian, true)
+	if err := e.writeBody(body, ds, tsuid); err != nil {
+		return err
+	}
+	if err := body.Flush(); err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return dcmerr.Errorf(dcmerr.ErrIO, "error closing deflate writer - %v", err.Error())
+	}
+	// Deflated stream is padded to even length with a NULL byte
+	if w.BytesWritten()%2 != 0 {
+		if _, err := w.Write([]byte{0}); err != nil {
+			return dcmerr.Errorf(dcmerr.ErrIO,
+				"error near byte %v (%08x) - %v", w.BytesWritten(), w.BytesWritten(), err.Error())
+		}
+	}
+	return w.Flush()
+}
+
+func (e *encoder) writeFileMeta(w Writer, ds *Dataset) error {
+	// Encode the group first to calculate FileMetaInformationGroupLength
+	var buf bytes.Buffer
+	meta := NewWriter(&buf, binary.LittleEndian, true)
+	iter := ds.Iterator()
+	for iter.Next() {
+		elem := iter.Value()
+		if elem.Tag>>16 != 0x0002 || elem.Tag == tag.FileMetaInformationGroupLength {
+			continue
+		}
+		if err := e.writeElement(meta, elem); err != nil {
+			return err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if err := meta.Flush(); err != nil {
+		return err
+	}
+	// Uint32 slice can't create errors
+	groupLen, _ := NewValue([]uint32{uint32(buf.Len())})
+	if err := e.writeElement(w, NewElement(tag.FileMetaInformationGroupLength, "UL", 4, groupLen)); err != nil {
+		return err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return dcmerr.Errorf(dcmerr.ErrIO,
+			"error near byte %v (%08x) - %v", w.BytesWritten(), w.BytesWritten(), err.Error())
+	}
+	return nil
+}
+
+func (e *encoder) writeFragment(w Writer, data []byte) error {
+	// Fragments must have even length
+	pad := len(data) % 2
+	if err := e.writeMarker(w, SQItem, uint32(len(data)+pad)); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return dcmerr.Errorf(dcmerr.ErrIO,
+			"error near byte %v (%08x) - %v", w.BytesWritten(), w.BytesWritten(), err.Error())
+	}
+	if pad != 0 {
+		if _, err := w.Write([]byte{0}); err != nil {
+			return dcmerr.Errorf(dcmerr.ErrIO,
+				"error near byte %v (%08x) - %v", w.BytesWritten(), w.BytesWritten(), err.Error())
+		}
+	}
+	return nil
+}
+
+func (e *encoder) writeHeader(w Writer) error {
+	preamble := make([]byte, preambleLength)
+	if _, err := w.Write(preamble); err != nil {
+		return dcmerr.Errorf(dcmerr.ErrIO, "error writing preamble - %v", err.Error())
+	}
+	return w.WriteString(magic)
+}
+
+// Write a tag with a 32 bit length and no VR, as used by SQ items and delimiters
+func (e *encoder) writeMarker(w Writer, tag32, vl uint32) error {
+	if err := e.writeTag(w, tag32); err != nil {
+		return err
+	}
+	return w.WriteUint32(vl)
+}
+
+func (e *encoder) writeSequence(w Writer, elem *Element, sq *sqValue) error {
+	if e.isUndefinedLength(elem) {
+		if err := e.writeElementHeader(w, elem.Tag, "SQ", UndefinedLength); err != nil {
+			return err
+		}
+		for _, item := range sq.value {
+			if err := e.writeMarker(w, SQItem, UndefinedLength); err != nil {
+				return err
+			}
+			if err := e.writeDataset(w, item); err != nil {
+				return err
+			}
+			if err := e.writeMarker(w, SQItemDelim, 0); err != nil {
+				return err
+			}
+		}
+		return e.writeMarker(w, SQDelim, 0)
+	}
+
+	// Defined length, encode the items first to calculate the length
+	var buf bytes.Buffer
+	items := NewWriter(&buf, w.ByteOrder(), w.IsExplicit())
+	for _, item := range sq.value {
+		data, err := e.encodeDataset(w.ByteOrder(), w.IsExplicit(), item)
+		if err != nil {
+			return err
+		}
+		if err := e.writeMarker(items, SQItem, uint32(len(data))); err != nil {
+			return err
+		}
+		if _, err := items.Write(data); err != nil {
+			return dcmerr.Errorf(dcmerr.ErrIO, "error encoding SQ item - %v", err.Error())
+		}
+	}
+	if err := items.Flush(); err != nil {
+		return err
+	}
+	if err := e.writeElementHeader(w, elem.Tag, "SQ", uint32(buf.Len())); err != nil {
+		return err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return dcmerr.Errorf(dcmerr.ErrIO,
+			"error near byte %v (%08x) - %v", w.BytesWritten(), w.BytesWritten(), err.Error())
+	}
+	return nil
+}
+
+// Write a sequence kept as UN, which is always undefined length with the
+// items encoded in ImpLE regardless of TransferSyntax
+func (e *encoder) writeUNSequence(w Writer, elem *Element, sq *sqValue) error {
+	if err := e.writeElementHeader(w, elem.Tag, "UN", UndefinedLength); err != nil {
+		return err
+	}
+	order, explicit := w.ByteOrder(), w.IsExplicit()
+	w.SetByteOrder(binary.LittleEndian)
+	w.SetExplicit(false)
+	defer func() {
+		w.SetByteOrder(order)
+		w.SetExplicit(explicit)
+	}()
+	for _, item := range sq.value {
+		if err := e.writeMarker(w, SQItem, UndefinedLength); err != nil {
+			return err
+		}
+		if err := e.writeDataset(w, item); err != nil {
+			return err
+		}
+		if err := e.writeMarker(w, SQItemDelim, 0); err != nil {
+			return err
+		}
+	}
+	return e.writeMarker(w, SQDelim, 0)
+}
+
+func (e *encoder) writeTag(w Writer, tag32 uint32) error {
+	if err := w.WriteUint16(uint16(tag32 >> 16)); err != nil {
+		return err
+	}
+	return w.WriteUint16(uint16(tag32))
+}
@@ -0,0 +1,164 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/tag"
+	"github.com/JamesDarcy616/dicom/uid"
+)
+
+func roundTripDataset(t *testing.T) *Dataset {
+	code := NewDataset()
+	code.Put(testElement(t, tag.CodeValue, "SH", "121311"))
+	code.Put(testElement(t, tag.CodingSchemeDesignator, "SH", "DCM"))
+	ref := NewDataset()
+	ref.Put(testElement(t, tag.ReferencedSOPClassUID, "UI", "1.2.840.10008.5.1.4.1.1.2"))
+	ref.Put(testElement(t, tag.ReferencedSOPInstanceUID, "UI", "1.2.3.4.5"))
+	ref.Put(NewElement(tag.PurposeOfReferenceCodeSequence, "SQ", UndefinedLength,
+		testValue(t, []*Dataset{code})))
+
+	ref2 := NewDataset()
+	ref2.Put(testElement(t, tag.ReferencedSOPInstanceUID, "UI", "1.2.3.4.6"))
+
+	ds := NewDataset()
+	ds.Put(testElement(t, tag.StudyDate, "DA", "20221014"))
+	ds.Put(testElement(t, tag.StudyDescription, "LO", "Round trip"))
+	ds.Put(NewElement(tag.ReferencedImageSequence, "SQ", 0, testValue(t, []*Dataset{ref, ref2})))
+	ds.Put(testElement(t, tag.SimpleFrameList, "UL", []uint32{1, 2, 70000}))
+	ds.Put(testElement(t, tag.TimeRange, "FD", []float64{0.5, 1.25}))
+	ds.Put(testElement(t, tag.RecommendedDisplayFrameRateInFloat, "FL", []float32{29.97}))
+	ds.Put(testElement(t, tag.PatientName, "PN", "Doe^John"))
+	ds.Put(testElement(t, tag.PatientID, "LO", "ID1"))
+	ds.Put(testElement(t, tag.InstanceNumber, "IS", "7"))
+	ds.Put(testElement(t, tag.ImagePositionPatient, "DS", "-1.5\\2\\3.25"))
+	ds.Put(testElement(t, tag.DimensionIndexPointer, "AT", []AttributeTag{AttributeTag(tag.ImagePositionPatient)}))
+	ds.Put(testElement(t, tag.Rows, "US", []uint16{512}))
+	ds.Put(testElement(t, tag.EncapsulatedDocument, "OB", []byte{1, 2, 3}))
+	return ds
+}
+
+// Compare the VR and values of every element of want with got, recursing
+// into sequences
+func compareDatasets(t *testing.T, path string, want, got *Dataset) {
+	t.Helper()
+	iter := want.Iterator()
+	for iter.Next() {
+		w := iter.Value()
+		g, err := got.Get(w.Tag)
+		if err != nil {
+			t.Errorf("%v%08x: %v", path, w.Tag, err)
+			continue
+		}
+		if g.VR != w.VR {
+			t.Errorf("%v%08x: VR %v, want %v", path, w.Tag, g.VR, w.VR)
+		}
+		if wantSQ, ok := w.Value.(*sqValue); ok {
+			gotSQ, ok := g.Value.(*sqValue)
+			if !ok || len(gotSQ.value) != len(wantSQ.value) {
+				t.Errorf("%v%08x: got %v, want %v items", path, w.Tag, g, len(wantSQ.value))
+				continue
+			}
+			for i := range wantSQ.value {
+				compareDatasets(t, path+tag.Name(w.Tag)+">", wantSQ.value[i], gotSQ.value[i])
+			}
+			continue
+		}
+		wantValue := w.Value.GetAll()
+		if b, ok := wantValue.([]byte); ok && len(b)%2 != 0 {
+			// Odd length bytes are padded with NULL
+			wantValue = append(b, 0)
+		}
+		if !reflect.DeepEqual(g.Value.GetAll(), wantValue) {
+			t.Errorf("%v%08x: got %v, want %v", path, w.Tag, g.Value.GetAll(), wantValue)
+		}
+	}
+}
+
+func TestWriteFileRoundTrip(t *testing.T) {
+	syntaxes := []string{
+		uid.ExplicitVRLittleEndian,
+		uid.ImplicitVRLittleEndian,
+		uid.ExplicitVRBigEndian,
+		uid.DeflatedExplicitVRLittleEndian,
+	}
+	options := map[string]WriteOption{
+		"defined":   WithDefinedLengthSequences(),
+		"undefined": WithUndefinedLengthSequences(),
+	}
+	for _, tsuid := range syntaxes {
+		for name, opt := range options {
+			ds := roundTripDataset(t)
+			filename := testFile(t, ds, tsuid, opt)
+			out, err := NewParser().ParseFile(filename)
+			if err != nil {
+				t.Fatalf("%v %v: %v", tsuid, name, err)
+			}
+			compareDatasets(t, tsuid+" "+name+": ", ds, out)
+			sq, _ := out.Get(tag.ReferencedImageSequence)
+			if undefined := sq.VL == UndefinedLength; undefined != (name == "undefined") {
+				t.Errorf("%v %v: SQ VL %08x", tsuid, name, sq.VL)
+			}
+		}
+	}
+}
+
+// VRs with a 32 bit length in explicit VR, the strings are longer than a 16
+// bit length allows
+func TestWriteFileLongVRs(t *testing.T) {
+	for _, tsuid := range []string{uid.ExplicitVRLittleEndian, uid.ImplicitVRLittleEndian} {
+		ds := NewDataset()
+		ds.Put(testElement(t, tag.SelectorSVValue, "SV", []int64{math.MinInt64, -1, math.MaxInt64}))
+		ds.Put(testElement(t, tag.SelectorUVValue, "UV", []uint64{0, math.MaxUint64}))
+		ds.Put(testElement(t, tag.LongCodeValue, "UC", strings.Repeat("c", 70000)+"\\second"))
+		// UR and UT are single valued so not split on backslash
+		ds.Put(NewElement(tag.RetrieveURL, "UR", 0,
+			newStringValue("UR", "https://example.com/wado?requestType=WADO&studyUID=1.2.3")))
+		ds.Put(NewElement(tag.PrivateDataElementDescription, "UT", 0,
+			newStringValue("UT", strings.Repeat("t\\", 35000)+"end")))
+		out, err := NewParser().ParseFile(testFile(t, ds, tsuid))
+		if err != nil {
+			t.Fatalf("%v: %v", tsuid, err)
+		}
+		compareDatasets(t, tsuid+": ", ds, out)
+		if values, _ := out.GetStrings(tag.LongCodeValue); len(values) != 2 || values[1] != "second" {
+			t.Errorf("%v: UC has %v values", tsuid, len(values))
+		}
+		if values, _ := out.GetStrings(tag.PrivateDataElementDescription); len(values) != 1 {
+			t.Errorf("%v: UT has %v values", tsuid, len(values))
+		}
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+// Inclusive range of groups, a single group has First equal to Last
+type GroupRange struct {
+	First uint16
+	Last  uint16
+}
+
+func (g GroupRange) Contains(tag32 uint32) bool {
+	group := uint16(tag32 >> 16)
+	return group >= g.First && group <= g.Last
+}
+
+// True if elem is filtered out by the include and exclude options. Only top
+// level elements are filtered, the file meta and sequence items are read in
+// full.
+func (p *Parser) isExcluded(elem *Element) bool {
+	if p.depth > 0 || elem.Tag>>16 == 0x0002 {
+		return false
+	}
+	if len(p.opts.IncludeTags) > 0 || len(p.opts.IncludeGroups) > 0 {
+		if !containsTag(p.opts.IncludeTags, elem.Tag) && !inGroups(p.opts.IncludeGroups, elem.Tag) {
+			return true
+		}
+	}
+	if p.opts.ExcludePrivate && (elem.Tag>>16)%2 == 1 {
+		return true
+	}
+	return containsTag(p.opts.ExcludeTags, elem.Tag) || inGroups(p.opts.ExcludeGroups, elem.Tag)
+}
+
+func containsTag(tags []uint32, tag32 uint32) bool {
+	for _, t := range tags {
+		if t == tag32 {
+			return true
+		}
+	}
+	return false
+}
+
+func inGroups(groups []GroupRange, tag32 uint32) bool {
+	for _, g := range groups {
+		if g.Contains(tag32) {
+			return true
+		}
+	}
+	return false
+}
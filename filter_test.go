@@ -0,0 +1,118 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/tag"
+	"github.com/JamesDarcy616/dicom/uid"
+)
+
+// A file with elements in groups 0008, 0009 (private), 0010 and 7fe0, and a
+// sequence whose item is never filtered
+func filterFile(t *testing.T) string {
+	t.Helper()
+	item := NewDataset()
+	item.Put(testElement(t, tag.PatientID, "LO", "nested"))
+	ds := NewDataset()
+	ds.Put(testElement(t, tag.StudyDate, "DA", "20221014"))
+	ds.Put(testElement(t, 0x00090010, "LO", "PRIVATE"))
+	ds.Put(testElement(t, 0x00091000, "LO", "private"))
+	ds.Put(testElement(t, tag.PatientName, "PN", "Doe^John"))
+	ds.Put(testElement(t, tag.PatientID, "LO", "ID1"))
+	ds.Put(NewElement(tag.OtherPatientIDsSequence, "SQ", 0, testValue(t, []*Dataset{item})))
+	ds.Put(testElement(t, tag.PixelData, "OB", make([]byte, 1024)))
+	return testFile(t, ds, uid.ExplicitVRLittleEndian)
+}
+
+func TestFilter(t *testing.T) {
+	filename := filterFile(t)
+	all := []uint32{tag.StudyDate, 0x00090010, 0x00091000, tag.PatientName,
+		tag.PatientID, tag.OtherPatientIDsSequence, tag.PixelData}
+	for _, c := range []struct {
+		name string
+		opts ParseOptions
+		want []uint32
+	}{
+		{"none", ParseOptions{}, all},
+		{"include tags", ParseOptions{IncludeTags: []uint32{tag.PatientName, tag.OtherPatientIDsSequence}},
+			[]uint32{tag.PatientName, tag.OtherPatientIDsSequence}},
+		{"include groups", ParseOptions{IncludeGroups: []GroupRange{{First: 0x0008, Last: 0x0009}}},
+			[]uint32{tag.StudyDate, 0x00090010, 0x00091000}},
+		{"include tags and groups", ParseOptions{
+			IncludeTags:   []uint32{tag.PixelData},
+			IncludeGroups: []GroupRange{{First: 0x0010, Last: 0x0010}},
+			ExcludeTags:   []uint32{tag.PatientID},
+		}, []uint32{tag.PatientName, tag.OtherPatientIDsSequence, tag.PixelData}},
+		{"exclude tags", ParseOptions{ExcludeTags: []uint32{tag.StudyDate, tag.OtherPatientIDsSequence}},
+			[]uint32{0x00090010, 0x00091000, tag.PatientName, tag.PatientID, tag.PixelData}},
+		{"exclude pixel data group", ParseOptions{ExcludeGroups: []GroupRange{{First: 0x7fe0, Last: 0x7fe0}}},
+			all[:len(all)-1]},
+		{"exclude private", ParseOptions{ExcludePrivate: true},
+			[]uint32{tag.StudyDate, tag.PatientName, tag.PatientID, tag.OtherPatientIDsSequence, tag.PixelData}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ds, err := NewParserWithOptions(c.opts).ParseFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// File meta is always read
+			if _, err := ds.Get(tag.TransferSyntaxUID); err != nil {
+				t.Error("TransferSyntaxUID filtered")
+			}
+			for _, tag32 := range all {
+				_, err := ds.Get(tag32)
+				if want := containsTag(c.want, tag32); (err == nil) != want {
+					t.Errorf("element %08x present %v, want %v", tag32, err == nil, want)
+				}
+			}
+			// Items are read in full
+			if item, err := ds.GetSequenceItem(tag.OtherPatientIDsSequence, 0); err == nil {
+				if id, _ := item.GetString(tag.PatientID); id != "nested" {
+					t.Errorf("nested PatientID %q", id)
+				}
+			}
+		})
+	}
+}
+
+func TestGroupRange(t *testing.T) {
+	g := GroupRange{First: 0x0008, Last: 0x0010}
+	for tag32, want := range map[uint32]bool{
+		0x00070010: false, 0x00080000: true, 0x0010ffff: true, 0x00110010: false,
+	} {
+		if g.Contains(tag32) != want {
+			t.Errorf("%08x: Contains %v", tag32, !want)
+		}
+	}
+}
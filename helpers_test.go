@@ -0,0 +1,67 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/tag"
+)
+
+func testValue(t testing.TB, raw interface{}) Value {
+	t.Helper()
+	value, err := NewValue(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func testElement(t testing.TB, tag32 uint32, vr string, raw interface{}) *Element {
+	t.Helper()
+	return NewElement(tag32, vr, 0, testValue(t, raw))
+}
+
+// Write ds as a Part 10 file in a temporary directory with file meta for the
+// TransferSyntax
+func testFile(t testing.TB, ds *Dataset, tsuid string, opts ...WriteOption) string {
+	t.Helper()
+	ds.Put(testElement(t, tag.MediaStorageSOPClassUID, "UI", "1.2.840.10008.5.1.4.1.1.7"))
+	ds.Put(testElement(t, tag.MediaStorageSOPInstanceUID, "UI", "1.2.3.4"))
+	ds.Put(testElement(t, tag.TransferSyntaxUID, "UI", tsuid))
+	filename := filepath.Join(t.TempDir(), "test.dcm")
+	if err := WriteFile(filename, ds, opts...); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
@@ -0,0 +1,220 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
+)
+
+// Implemented by values that are loaded from their source on first access
+type Loader interface {
+	Load() error
+	Loaded() bool
+}
+
+// Reads from a file by name so no file is held open between loads
+type fileSource string
+
+func (f fileSource) ReadAt(buf []byte, off int64) (int, error) {
+	file, err := os.Open(string(f))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return file.ReadAt(buf, off)
+}
+
+// A value recorded as an offset and length into its source, read and decoded
+// on first access. If loading fails Get and GetAll return the error from Load
+// in place of the value and the error is kept for later calls.
+type lazyValue struct {
+	mutex   sync.Mutex
+	src     io.ReaderAt
+	offset  uint64
+	length  uint64
+	vr      string
+	vl      uint32
+	order   binary.ByteOrder
+	charset *charset
+	value   Value
+	err     error
+}
+
+func (v *lazyValue) Get() interface{} {
+	if err := v.Load(); err != nil {
+		return err
+	}
+	return v.value.Get()
+}
+
+func (v *lazyValue) GetAll() interface{} {
+	if err := v.Load(); err != nil {
+		return err
+	}
+	return v.value.GetAll()
+}
+
+// Answered from the length without loading, except for string values which
+// are empty if they are only padding
+func (v *lazyValue) IsEmpty() bool {
+	if v.length == 0 {
+		return true
+	}
+	if !isStringVR(v.vr) {
+		return false
+	}
+	if err := v.Load(); err != nil {
+		return false
+	}
+	return v.value.IsEmpty()
+}
+
+func (v *lazyValue) Len() int {
+	if err := v.Load(); err != nil {
+		return 0
+	}
+	return v.value.Len()
+}
+
+func (v *lazyValue) Load() error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.value != nil || v.err != nil {
+		return v.err
+	}
+	buf := make([]byte, v.length)
+	if _, err := v.src.ReadAt(buf, int64(v.offset)); err != nil {
+		v.err = dcmerr.Errorf(dcmerr.ErrIO,
+			"error loading value at byte %v (%08x) - %v", v.offset, v.offset, err.Error())
+		return v.err
+	}
+	r := NewReader(bytes.NewReader(buf), v.order, true)
+	p := NewParser()
+	p.charset = v.charset
+	v.value, v.err = p.readValue(r, v.vr, v.vl)
+	return v.err
+}
+
+func (v *lazyValue) Loaded() bool {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.value != nil
+}
+
+func (v *lazyValue) String() string {
+	if err := v.Load(); err != nil {
+		return err.Error()
+	}
+	return v.value.String()
+}
+
+func (v *lazyValue) format() string {
+	v.mutex.Lock()
+	err := v.err
+	v.mutex.Unlock()
+	if err != nil {
+		return err.Error()
+	}
+	if !v.Loaded() {
+		return fmt.Sprintf("%v bytes not loaded", v.length)
+	}
+	return (&Element{Value: v.value}).formatValue(64)
+}
+
+// Values read by readStringValue or readTextValue
+func isStringVR(vr string) bool {
+	switch vr {
+	case "AE", "AS", "CS", "DA", "DS", "DT", "IS", "TM", "UI", "UR",
+		"LO", "LT", "PN", "SH", "ST", "UC", "UT":
+		return true
+	}
+	return false
+}
+
+// Unwrap values loaded on first access, loading them if required
+func resolveValue(value Value) (Value, error) {
+	lazy, ok := value.(*lazyValue)
+	if !ok {
+		return value, nil
+	}
+	if err := lazy.Load(); err != nil {
+		return nil, err
+	}
+	return lazy.value, nil
+}
+
+func (p *Parser) isLazy(elem *Element) bool {
+	// SpecificCharacterSet is needed to decode the text values that follow
+	if p.source == nil || p.isSequence(elem) || elem.Tag == tag.SpecificCharacterSet {
+		return false
+	}
+	for _, tag32 := range p.opts.LazyLoadTags {
+		if elem.Tag == tag32 {
+			return true
+		}
+	}
+	// Undefined length values (encapsulated pixel data) are assumed to be large
+	return p.opts.LazyLoadSize > 0 && elem.VL > p.opts.LazyLoadSize
+}
+
+// Record the position of the value and skip over it
+func (p *Parser) readLazyValue(r Reader, elem *Element) (*Element, error) {
+	offset := r.BytesRead()
+	var err error
+	if elem.VL == UndefinedLength {
+		err = p.skipEncapsulated(r)
+	} else {
+		err = r.Skip(int64(elem.VL))
+	}
+	if err != nil {
+		return nil, dcmerr.Errorf(dcmerr.ErrIO,
+			"error near byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
+	}
+	elem.Value = &lazyValue{
+		src:     p.source,
+		offset:  offset,
+		length:  r.BytesRead() - offset,
+		vr:      elem.VR,
+		vl:      elem.VL,
+		order:   r.ByteOrder(),
+		charset: p.charset,
+	}
+	return elem, nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
+	"github.com/JamesDarcy616/dicom/uid"
+)
+
+// A file with large OB, LT and padding only LT values read on first access
+func lazyFile(t *testing.T) (string, *Dataset) {
+	t.Helper()
+	ds := NewDataset()
+	ds.Put(testElement(t, tag.ImageComments, "LT", strings.Repeat("x", 300)))
+	ds.Put(testElement(t, tag.AdditionalPatientHistory, "LT", strings.Repeat(" ", 300)))
+	ds.Put(testElement(t, tag.PixelData, "OB", bytes.Repeat([]byte{7}, 1024)))
+	filename := testFile(t, ds, uid.ExplicitVRLittleEndian)
+	out, err := NewParserWithOptions(ParseOptions{LazyLoadSize: 256}).ParseFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename, out
+}
+
+func lazyLoader(t *testing.T, ds *Dataset, tag32 uint32) Loader {
+	t.Helper()
+	elem, err := ds.Get(tag32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loader, ok := elem.Value.(Loader)
+	if !ok {
+		t.Fatalf("%08x not lazy", tag32)
+	}
+	return loader
+}
+
+func TestLazyLoad(t *testing.T) {
+	_, ds := lazyFile(t)
+
+	pixels := lazyLoader(t, ds, tag.PixelData)
+	elem, _ := ds.Get(tag.PixelData)
+	if elem.Value.IsEmpty() || pixels.Loaded() {
+		t.Errorf("IsEmpty of OB loaded %v", pixels.Loaded())
+	}
+	value, err := ds.GetBytes(tag.PixelData)
+	if err != nil || !bytes.Equal(value, bytes.Repeat([]byte{7}, 1024)) || !pixels.Loaded() {
+		t.Errorf("GetBytes %v, loaded %v", err, pixels.Loaded())
+	}
+
+	// Padding only strings are loaded to find they are empty
+	padding := lazyLoader(t, ds, tag.AdditionalPatientHistory)
+	elem, _ = ds.Get(tag.AdditionalPatientHistory)
+	if !elem.Value.IsEmpty() || !padding.Loaded() {
+		t.Error("padding only LT not empty")
+	}
+	elem, _ = ds.Get(tag.ImageComments)
+	if elem.Value.IsEmpty() {
+		t.Error("LT empty")
+	}
+	if s, err := ds.GetString(tag.ImageComments); err != nil || s != strings.Repeat("x", 300) {
+		t.Errorf("GetString %v", err)
+	}
+}
+
+func TestLazyLoadError(t *testing.T) {
+	filename, ds := lazyFile(t)
+	// Remove all the lazy values
+	if err := os.Truncate(filename, 200); err != nil {
+		t.Fatal(err)
+	}
+
+	isErrIO := func(err error) bool {
+		derr, ok := err.(dcmerr.DicomError)
+		return ok && derr.Code() == dcmerr.ErrIO
+	}
+	pixels := lazyLoader(t, ds, tag.PixelData)
+	if err := pixels.Load(); !isErrIO(err) {
+		t.Fatalf("Load %v", err)
+	}
+	elem, _ := ds.Get(tag.PixelData)
+	if err, _ := elem.Value.Get().(error); !isErrIO(err) {
+		t.Errorf("Get %v", elem.Value.Get())
+	}
+	if err, _ := elem.Value.GetAll().(error); !isErrIO(err) {
+		t.Errorf("GetAll %v", elem.Value.GetAll())
+	}
+	if elem.Value.IsEmpty() {
+		t.Error("IsEmpty after error")
+	}
+	if _, err := ds.GetBytes(tag.PixelData); !isErrIO(err) {
+		t.Errorf("GetBytes %v", err)
+	}
+	if _, err := ds.GetString(tag.ImageComments); !isErrIO(err) {
+		t.Errorf("GetString %v", err)
+	}
+	if _, err := ds.GetStrings(tag.ImageComments); !isErrIO(err) {
+		t.Errorf("GetStrings %v", err)
+	}
+	if !strings.Contains(elem.String(), "error loading value") {
+		t.Errorf("String %v", elem.String())
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
+	"github.com/JamesDarcy616/dicom/uid"
+)
+
+// A file with a 1000 byte value and sequences nested two deep
+func limitsFile(t *testing.T) string {
+	t.Helper()
+	inner := NewDataset()
+	inner.Put(testElement(t, tag.CodeValue, "SH", "123"))
+	outer := NewDataset()
+	outer.PutSequence(tag.ConceptNameCodeSequence, inner)
+	ds := NewDataset()
+	ds.PutSequence(tag.ContentSequence, outer)
+	ds.Put(testElement(t, tag.PixelData, "OB", make([]byte, 1000)))
+	return testFile(t, ds, uid.ExplicitVRLittleEndian)
+}
+
+func TestContextCancelled(t *testing.T) {
+	filename := limitsFile(t)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	walk := func(path []uint32, elem *Element) (Action, error) { return WalkRead, nil }
+	p := NewParser()
+	for name, parse := range map[string]func() error{
+		"ParseContext": func() error {
+			_, err := p.ParseContext(ctx, bytes.NewReader(data[132:]), true)
+			return err
+		},
+		"ParseFileContext": func() error {
+			_, err := p.ParseFileContext(ctx, filename)
+			return err
+		},
+		"ParseFileUntilContext": func() error {
+			_, err := p.ParseFileUntilContext(ctx, filename, tag.PixelData)
+			return err
+		},
+		"ParseFileUntilFuncContext": func() error {
+			_, err := p.ParseFileUntilFuncContext(ctx, filename, UntilTags([]uint32{tag.PixelData}))
+			return err
+		},
+		"ParseReaderAtContext": func() error {
+			_, err := p.ParseReaderAtContext(ctx, bytes.NewReader(data), int64(len(data)))
+			return err
+		},
+		"WalkContext": func() error {
+			return p.WalkContext(ctx, bytes.NewReader(data[132:]), true, walk)
+		},
+		"WalkFileContext": func() error {
+			return p.WalkFileContext(ctx, filename, walk)
+		},
+	} {
+		if err := parse(); !dcmerr.IsErrCancelled(err) {
+			t.Errorf("%v: %v", name, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	filename := limitsFile(t)
+	for _, c := range []struct {
+		name  string
+		opts  ParseOptions
+		check func(error) bool
+	}{
+		{"length", ParseOptions{MaxElementLength: 999}, dcmerr.IsErrLengthLimit},
+		{"depth", ParseOptions{MaxDepth: 1}, dcmerr.IsErrDepthLimit},
+		{"size", ParseOptions{MaxBytes: 500}, dcmerr.IsErrSizeLimit},
+	} {
+		// Limits fail even in lenient mode
+		for _, lenient := range []bool{false, true} {
+			c.opts.Lenient = lenient
+			ds, err := NewParserWithOptions(c.opts).ParseFile(filename)
+			if !c.check(err) || ds != nil {
+				t.Errorf("%v lenient %v: %v", c.name, lenient, err)
+			}
+		}
+	}
+	opts := ParseOptions{MaxElementLength: 1000, MaxDepth: 2, MaxBytes: 2000}
+	if _, err := NewParserWithOptions(opts).ParseFile(filename); err != nil {
+		t.Errorf("within limits: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+//go:build linux
+
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+)
+
+// A file mapped read-only into memory, for use with ParseReaderAt
+type MappedFile struct {
+	mutex sync.RWMutex
+	data  []byte
+	open  bool
+}
+
+func OpenMapped(filename string) (*MappedFile, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	// The mapping remains valid after the file is closed
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	m := &MappedFile{open: true}
+	if info.Size() == 0 {
+		return m, nil
+	}
+	m.data, err = syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, dcmerr.Errorf(dcmerr.ErrIO, "error mapping %v - %v", filename, err.Error())
+	}
+	return m, nil
+}
+
+func (m *MappedFile) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.open {
+		return nil
+	}
+	m.open = false
+	if m.data == nil {
+		return nil
+	}
+	data := m.data
+	m.data = nil
+	return syscall.Munmap(data)
+}
+
+func (m *MappedFile) ReadAt(buf []byte, off int64) (int, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if !m.open {
+		return 0, os.ErrClosed
+	}
+	if off < 0 {
+		return 0, dcmerr.Errorf(dcmerr.ErrIO, "negative offset %v", off)
+	}
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(buf, m.data[off:])
+	if n < len(buf) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *MappedFile) Size() int64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return int64(len(m.data))
+}
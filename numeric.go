@@ -0,0 +1,363 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+)
+
+const (
+	maxDSLength = 16
+	maxISLength = 12
+)
+
+// All values of a DS, IS or binary numeric element as float64
+func (ds *Dataset) GetFloats(tag uint32) ([]float64, error) {
+	elem, err := ds.loadedElement(tag)
+	if err != nil {
+		return nil, err
+	}
+	if isUntypedEmpty(elem.Value) {
+		return []float64{}, nil
+	}
+	var out []float64
+	switch value := elem.Value.GetAll().(type) {
+	case []string:
+		if elem.VR != "DS" && elem.VR != "IS" {
+			return nil, dcmerr.Errorf(dcmerr.ErrNotConvertible,
+				"Cannot convert element 0x%08x with VR %v to []float64", tag, elem.VR)
+		}
+		out = make([]float64, len(value))
+		for i, str := range value {
+			f, err := strconv.ParseFloat(str, 64)
+			if err != nil {
+				return nil, dcmerr.Errorf(dcmerr.ErrNotConvertible,
+					"Cannot convert element 0x%08x value %q to float64", tag, str)
+			}
+			out[i] = f
+		}
+	case []float32:
+		out = make([]float64, len(value))
+		for i, v := range value {
+			out[i] = float64(v)
+		}
+	case []float64:
+		out = append([]float64{}, value...)
+	case []uint16:
+		out = make([]float64, len(value))
+		for i, v := range value {
+			out[i] = float64(v)
+		}
+	case []int16:
+		out = make([]float64, len(value))
+		for i, v := range value {
+			out[i] = float64(v)
+		}
+	case []uint32:
+		out = make([]float64, len(value))
+		for i, v := range value {
+			out[i] = float64(v)
+		}
+	case []int32:
+		out = make([]float64, len(value))
+		for i, v := range value {
+			out[i] = float64(v)
+		}
+	case []uint64:
+		out = make([]float64, len(value))
+		for i, v := range value {
+			out[i] = float64(v)
+		}
+	case []int64:
+		out = make([]float64, len(value))
+		for i, v := range value {
+			out[i] = float64(v)
+		}
+	default:
+		return nil, dcmerr.Errorf(dcmerr.ErrNotConvertible,
+			"Cannot convert element 0x%08x to []float64", tag)
+	}
+	return out, nil
+}
+
+// All values of an IS, DS or binary numeric element as int64, fails if a
+// value is not integral or out of range
+func (ds *Dataset) GetInts(tag uint32) ([]int64, error) {
+	elem, err := ds.loadedElement(tag)
+	if err != nil {
+		return nil, err
+	}
+	if isUntypedEmpty(elem.Value) {
+		return []int64{}, nil
+	}
+	var out []int64
+	switch value := elem.Value.GetAll().(type) {
+	case []string:
+		if elem.VR != "IS" {
+			break
+		}
+		out = make([]int64, len(value))
+		for i, str := range value {
+			n, err := strconv.ParseInt(strings.TrimPrefix(str, "+"), 10, 64)
+			if err != nil {
+				return nil, dcmerr.Errorf(dcmerr.ErrNotConvertible,
+					"Cannot convert element 0x%08x value %q to int64", tag, str)
+			}
+			out[i] = n
+		}
+		return out, nil
+	case []uint16:
+		out = make([]int64, len(value))
+		for i, v := range value {
+			out[i] = int64(v)
+		}
+		return out, nil
+	case []int16:
+		out = make([]int64, len(value))
+		for i, v := range value {
+			out[i] = int64(v)
+		}
+		return out, nil
+	case []uint32:
+		out = make([]int64, len(value))
+		for i, v := range value {
+			out[i] = int64(v)
+		}
+		return out, nil
+	case []int32:
+		out = make([]int64, len(value))
+		for i, v := range value {
+			out[i] = int64(v)
+		}
+		return out, nil
+	case []int64:
+		return append([]int64{}, value...), nil
+	case []uint64:
+		out = make([]int64, len(value))
+		for i, v := range value {
+			if v > math.MaxInt64 {
+				return nil, dcmerr.Errorf(dcmerr.ErrNotConvertible,
+					"Cannot convert element 0x%08x value %v to int64", tag, v)
+			}
+			out[i] = int64(v)
+		}
+		return out, nil
+	}
+	// DS and floating point values must be integral
+	floats, err := ds.GetFloats(tag)
+	if err != nil {
+		return nil, dcmerr.Errorf(dcmerr.ErrNotConvertible,
+			"Cannot convert element 0x%08x to []int64", tag)
+	}
+	out = make([]int64, len(floats))
+	for i, f := range floats {
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return nil, dcmerr.Errorf(dcmerr.ErrNotConvertible,
+				"Cannot convert element 0x%08x value %v to int64", tag, f)
+		}
+		out[i] = int64(f)
+	}
+	return out, nil
+}
+
+// Put a DS element, each value is formatted in at most 16 bytes
+func (ds *Dataset) PutDecimalStrings(tag uint32, values ...float64) error {
+	strs := make([]string, len(values))
+	for i, f := range values {
+		str, err := formatDS(f)
+		if err != nil {
+			return err
+		}
+		strs[i] = str
+	}
+	return ds.PutString(tag, "DS", strings.Join(strs, "\\"))
+}
+
+// Put an IS element, values must be in the range of a signed 32 bit integer
+func (ds *Dataset) PutIntegerStrings(tag uint32, values ...int64) error {
+	strs := make([]string, len(values))
+	for i, n := range values {
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return dcmerr.Errorf(dcmerr.ErrNotConvertible, "IS value %v out of range", n)
+		}
+		strs[i] = strconv.FormatInt(n, 10)
+	}
+	return ds.PutString(tag, "IS", strings.Join(strs, "\\"))
+}
+
+// Format f as a DS value, reducing precision to fit 16 bytes
+func formatDS(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", dcmerr.Errorf(dcmerr.ErrNotConvertible, "DS value %v is not finite", f)
+	}
+	str := strconv.FormatFloat(f, 'g', -1, 64)
+	for prec := maxDSLength; !fitsDS(str) && prec > 0; prec-- {
+		str = strconv.FormatFloat(f, 'g', prec, 64)
+	}
+	return str, nil
+}
+
+// Rounding near the largest float64 can overflow to a value that won't parse
+func fitsDS(str string) bool {
+	_, err := strconv.ParseFloat(str, 64)
+	return len(str) <= maxDSLength && err == nil
+}
+
+// Check each value of a DS or IS string
+func validateNumberString(vrStr, str string) error {
+	if strings.TrimSpace(str) == "" {
+		return nil
+	}
+	for _, value := range strings.Split(str, "\\") {
+		trimmed := strings.TrimSpace(value)
+		switch vrStr {
+		case "DS":
+			f, err := strconv.ParseFloat(trimmed, 64)
+			if len(value) > maxDSLength || err != nil || !isDSString(trimmed) ||
+				math.IsNaN(f) || math.IsInf(f, 0) {
+				return dcmerr.Errorf(dcmerr.ErrNotConvertible, "invalid DS value %q", value)
+			}
+		case "IS":
+			n, err := strconv.ParseInt(strings.TrimPrefix(trimmed, "+"), 10, 64)
+			if len(value) > maxISLength || err != nil || n < math.MinInt32 || n > math.MaxInt32 {
+				return dcmerr.Errorf(dcmerr.ErrNotConvertible, "invalid IS value %q", value)
+			}
+		}
+	}
+	return nil
+}
+
+// DS allows only digits, sign, decimal point and exponent, ParseFloat also
+// accepts forms like "Inf", "0x1p-2" and "1_000"
+func isDSString(s string) bool {
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+		case c == '+', c == '-', c == '.', c == 'e', c == 'E':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// The unit of an AS value
+type AgeUnit byte
+
+const (
+	AgeDays   AgeUnit = 'D'
+	AgeWeeks  AgeUnit = 'W'
+	AgeMonths AgeUnit = 'M'
+	AgeYears  AgeUnit = 'Y'
+)
+
+// An AS value, a count of days, weeks, months or years
+type Age struct {
+	Value int
+	Unit  AgeUnit
+}
+
+// Parse an AS value nnnD, nnnW, nnnM or nnnY
+func ParseAge(s string) (Age, error) {
+	s = strings.TrimSpace(s)
+	if len(s) != 4 {
+		return Age{}, dcmerr.Errorf(dcmerr.ErrNotConvertible, "invalid AS %q", s)
+	}
+	n, ok := atoi(s[:3])
+	unit := AgeUnit(s[3])
+	switch unit {
+	case AgeDays, AgeWeeks, AgeMonths, AgeYears:
+	default:
+		ok = false
+	}
+	if !ok {
+		return Age{}, dcmerr.Errorf(dcmerr.ErrNotConvertible, "invalid AS %q", s)
+	}
+	return Age{Value: n, Unit: unit}, nil
+}
+
+func (a Age) String() string {
+	return fmt.Sprintf("%03d%c", a.Value, a.Unit)
+}
+
+// The time after t when the age is reached
+func (a Age) AddTo(t time.Time) time.Time {
+	switch a.Unit {
+	case AgeWeeks:
+		return t.AddDate(0, 0, 7*a.Value)
+	case AgeMonths:
+		return t.AddDate(0, a.Value, 0)
+	case AgeYears:
+		return t.AddDate(a.Value, 0, 0)
+	}
+	return t.AddDate(0, 0, a.Value)
+}
+
+// The approximate duration of the age, using average month and year lengths
+func (a Age) Duration() time.Duration {
+	day := 24 * time.Hour
+	switch a.Unit {
+	case AgeWeeks:
+		return time.Duration(a.Value) * 7 * day
+	case AgeMonths:
+		return time.Duration(float64(a.Value) * 30.436875 * float64(day))
+	case AgeYears:
+		return time.Duration(float64(a.Value) * 365.2425 * float64(day))
+	}
+	return time.Duration(a.Value) * day
+}
+
+func (ds *Dataset) GetAge(tag uint32) (Age, error) {
+	str, err := ds.GetString(tag)
+	if err != nil {
+		return Age{}, err
+	}
+	return ParseAge(str)
+}
+
+func (ds *Dataset) PutAge(tag uint32, age Age) error {
+	switch age.Unit {
+	case AgeDays, AgeWeeks, AgeMonths, AgeYears:
+	default:
+		return dcmerr.Errorf(dcmerr.ErrNotConvertible, "invalid AS unit %q", age.Unit)
+	}
+	if age.Value < 0 || age.Value > 999 {
+		return dcmerr.Errorf(dcmerr.ErrNotConvertible, "AS value %v out of range", age.Value)
+	}
+	return ds.PutString(tag, "AS", age.String())
+}
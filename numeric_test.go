@@ -0,0 +1,180 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
+)
+
+func TestFormatDS(t *testing.T) {
+	for _, f := range []float64{
+		0, 1, -1, 0.5, 1.0 / 3, -2.0 / 3, math.Pi * 1e10, 123456789012345678,
+		-1.2345678901234567e-123, 9.999999999999999e300, math.MaxFloat64, -math.SmallestNonzeroFloat64,
+	} {
+		str, err := formatDS(f)
+		if err != nil {
+			t.Errorf("%v: %v", f, err)
+			continue
+		}
+		if len(str) > maxDSLength {
+			t.Errorf("%v: %q is %v bytes", f, str, len(str))
+		}
+		if err := validateNumberString("DS", str); err != nil {
+			t.Errorf("%v: %v", f, err)
+		}
+		// Precision is only lost to fit the length
+		got, _ := strconv.ParseFloat(str, 64)
+		if math.Abs(got-f) > math.Abs(f)*1e-8 {
+			t.Errorf("%v: %q", f, str)
+		}
+	}
+	if str, _ := formatDS(0.1); str != "0.1" {
+		t.Errorf("0.1: %q", str)
+	}
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := formatDS(f); !dcmerr.IsErrNotConvertible(err) {
+			t.Errorf("%v: %v", f, err)
+		}
+		if err := NewDataset().PutDecimalStrings(tag.SliceThickness, 1, f); !dcmerr.IsErrNotConvertible(err) {
+			t.Errorf("PutDecimalStrings %v: %v", f, err)
+		}
+	}
+}
+
+func TestValidateNumberString(t *testing.T) {
+	for _, c := range []struct {
+		vr, s string
+		ok    bool
+	}{
+		{"DS", "1.5", true},
+		{"DS", " -1.5e-3 ", true},
+		{"DS", `1\+2.0\3E4`, true},
+		{"DS", "", true},
+		{"DS", "1.00000000000001", true},
+		{"DS", "1.000000000000001", false},
+		{"DS", "0x1p-2", false},
+		{"DS", "1_000", false},
+		{"DS", "Inf", false},
+		{"DS", "NaN", false},
+		{"DS", "1e999", false},
+		{"DS", `1\x`, false},
+		{"IS", "2147483647", true},
+		{"IS", "-2147483648", true},
+		{"IS", "+12", true},
+		{"IS", "2147483648", false},
+		{"IS", "-2147483649", false},
+		{"IS", "1.5", false},
+		{"IS", "1_000", false},
+		{"IS", " 0000000000001", false},
+	} {
+		err := validateNumberString(c.vr, c.s)
+		if c.ok != (err == nil) {
+			t.Errorf("%v %q: %v", c.vr, c.s, err)
+		}
+		if err != nil && !dcmerr.IsErrNotConvertible(err) {
+			t.Errorf("%v %q: error %v", c.vr, c.s, err)
+		}
+	}
+	if err := NewDataset().PutString(tag.SliceThickness, "DS", "0x1p-2"); !dcmerr.IsErrNotConvertible(err) {
+		t.Errorf("PutString DS %v", err)
+	}
+}
+
+func TestPutIntegerStrings(t *testing.T) {
+	ds := NewDataset()
+	if err := ds.PutIntegerStrings(tag.InstanceNumber, math.MinInt32, 0, math.MaxInt32); err != nil {
+		t.Fatal(err)
+	}
+	if ints, err := ds.GetInts(tag.InstanceNumber); err != nil || len(ints) != 3 || ints[2] != math.MaxInt32 {
+		t.Errorf("GetInts %v, %v", ints, err)
+	}
+	for _, n := range []int64{math.MaxInt32 + 1, math.MinInt32 - 1} {
+		if err := ds.PutIntegerStrings(tag.InstanceNumber, n); !dcmerr.IsErrNotConvertible(err) {
+			t.Errorf("%v: %v", n, err)
+		}
+	}
+}
+
+func TestAge(t *testing.T) {
+	start := time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		s        string
+		want     Age
+		end      time.Time
+		duration time.Duration
+	}{
+		{"010D", Age{10, AgeDays}, time.Date(2020, 2, 10, 0, 0, 0, 0, time.UTC), 240 * time.Hour},
+		{"002W", Age{2, AgeWeeks}, time.Date(2020, 2, 14, 0, 0, 0, 0, time.UTC), 336 * time.Hour},
+		{"001M", Age{1, AgeMonths}, time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC), time.Duration(30.436875 * 24 * float64(time.Hour))},
+		{"045Y ", Age{45, AgeYears}, time.Date(2065, 1, 31, 0, 0, 0, 0, time.UTC), time.Duration(45 * 365.2425 * 24 * float64(time.Hour))},
+	} {
+		age, err := ParseAge(c.s)
+		if err != nil || age != c.want {
+			t.Errorf("%q: %+v, %v", c.s, age, err)
+			continue
+		}
+		if end := age.AddTo(start); !end.Equal(c.end) {
+			t.Errorf("%q: AddTo %v, want %v", c.s, end, c.end)
+		}
+		if age.Duration() != c.duration {
+			t.Errorf("%q: Duration %v, want %v", c.s, age.Duration(), c.duration)
+		}
+
+		ds := NewDataset()
+		if err := ds.PutAge(tag.PatientAge, age); err != nil {
+			t.Fatal(err)
+		}
+		if str, _ := ds.GetString(tag.PatientAge); str+" " != c.s && str != c.s {
+			t.Errorf("%q: put %q", c.s, str)
+		}
+		if got, err := ds.GetAge(tag.PatientAge); err != nil || got != age {
+			t.Errorf("%q: round trip %+v, %v", c.s, got, err)
+		}
+	}
+	for _, s := range []string{"", "45Y", "045", "045X", "-45Y", "0045Y", "04 Y"} {
+		if _, err := ParseAge(s); !dcmerr.IsErrNotConvertible(err) {
+			t.Errorf("%q: %v", s, err)
+		}
+	}
+	ds := NewDataset()
+	for _, age := range []Age{{1000, AgeYears}, {-1, AgeDays}, {1, 'X'}} {
+		if err := ds.PutAge(tag.PatientAge, age); !dcmerr.IsErrNotConvertible(err) {
+			t.Errorf("PutAge %+v: %v", age, err)
+		}
+	}
+}
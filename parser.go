@@ -32,7 +32,10 @@ POSSIBILITY OF SUCH DAMAGE.
 package dicom
 
 import (
+	"compress/flate"
+	"context"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"os"
 	"sync"
@@ -40,9 +43,11 @@ import (
 	"github.com/JamesDarcy616/dicom/dcmerr"
 	"github.com/JamesDarcy616/dicom/tag"
 	"github.com/JamesDarcy616/dicom/uid"
+	"github.com/JamesDarcy616/dicom/vr"
 )
 
 const magic = "DICM"
+const preambleLength = 128
 const (
 	UndefinedLength = 0xffffffff
 	SQItem          = 0xfffee000
@@ -50,121 +55,309 @@ const (
 	SQDelim         = 0xfffee0dd
 )
 
+type ParseOptions struct {
+	// Keep the partial dataset on errors and recover where possible, problems
+	// are reported by Parser.Warnings
+	Lenient bool
+	// Change the VR of undefined length UN elements to SQ, they are always
+	// parsed as sequences
+	RetypeUNSequences bool
+	// Values longer than this are read from the file on first access instead
+	// of when parsing, 0 disables. Only applies to ParseFile and ParseFileUntil
+	// and not to deflated files.
+	LazyLoadSize uint32
+	// Values of these tags are always read from the file on first access
+	LazyLoadTags []uint32
+	// Limits on malformed or hostile input, 0 is unlimited. Exceeding them
+	// fails with ErrLengthLimit, ErrDepthLimit or ErrSizeLimit even in
+	// lenient mode.
+	MaxElementLength uint32
+	MaxDepth         int
+	MaxBytes         uint64
+	// Record the offset and original encoding of each element and SQ item,
+	// offsets in a deflated body are relative to the inflated stream
+	KeepSource bool
+	// Top level elements to read, all others are skipped without allocating
+	// their values. Empty reads all elements. File meta is always read.
+	IncludeTags   []uint32
+	IncludeGroups []GroupRange
+	// Top level elements to skip, applied after the include lists
+	ExcludeTags    []uint32
+	ExcludeGroups  []GroupRange
+	ExcludePrivate bool
+}
+
 type Parser struct {
 	// Protect internal state during a call
 	mutex sync.Mutex
+	opts  ParseOptions
+	ctx   context.Context
+	depth int
+	// Set while parsing until stop returns true, path holds the enclosing
+	// sequence tags
+	stop    StopFunc
+	stopped bool
+	path    []uint32
+	// From SpecificCharacterSet of the dataset being read, inherited by
+	// SQ items
+	charset *charset
+	// Reused by each call reading a file
+	file     *reader
+	source   io.ReaderAt
+	warnings []Warning
+}
+
+// A problem found and recovered from when parsing in lenient mode
+type Warning struct {
+	Offset  uint64
+	Tag     uint32
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("byte %v (%08x) element 0x%08x - %v", w.Offset, w.Offset, w.Tag, w.Message)
 }
 
 func NewParser() *Parser {
-	return &Parser{}
+	return &Parser{ctx: context.Background()}
+}
+
+func NewParserWithOptions(opts ParseOptions) *Parser {
+	return &Parser{opts: opts, ctx: context.Background()}
 }
 
 func (p *Parser) Parse(r io.Reader, explicit bool) (*Dataset, error) {
+	return p.ParseContext(context.Background(), r, explicit)
+}
+
+// Parse checking ctx for cancellation between elements
+func (p *Parser) ParseContext(ctx context.Context, r io.Reader, explicit bool) (*Dataset, error) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
+	p.reset(ctx)
 	ds := NewDataset()
 	reader := NewReader(r, binary.LittleEndian, explicit)
 	err := p.parseAll(ds, reader)
 	if err != nil {
-		return nil, err
+		return p.partialDataset(ds, reader, err)
 	}
 
 	return ds, nil
 }
 
 func (p *Parser) ParseFile(filename string) (*Dataset, error) {
+	return p.ParseFileContext(context.Background(), filename)
+}
+
+// ParseFile checking ctx for cancellation between elements
+func (p *Parser) ParseFileContext(ctx context.Context, filename string) (*Dataset, error) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
+	p.reset(ctx)
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
+	// Source of values loaded on first access
+	p.source = fileSource(filename)
+	defer func() { p.source = nil }()
 
-	// Start in ExpLE mode for file metadata
-	reader := NewReader(file, binary.LittleEndian, true)
-
-	if err := p.checkHeader(reader); err != nil {
-		return nil, err
-	}
-
-	ds := NewDataset()
-	err = p.parseFileMeta(ds, reader)
-	if err != nil {
-		return nil, err
-	}
-	if err := p.checkXferSyntax(ds, reader); err != nil {
-		return nil, err
-	}
-	err = p.parseAll(ds, reader)
-	if err != nil {
-		return nil, err
-	}
-
-	return ds, nil
+	// Start in ExpLE mode for file metadata, changed if there is none
+	reader := p.fileReader(file)
+	return p.parsePart10(reader, p.parseAll)
 }
 
 func (p *Parser) ParseFileUntil(filename string, maxTag uint32) (*Dataset, error) {
+	return p.ParseFileUntilContext(context.Background(), filename, maxTag)
+}
+
+// ParseFileUntil checking ctx for cancellation between elements
+func (p *Parser) ParseFileUntilContext(ctx context.Context, filename string, maxTag uint32) (*Dataset, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.reset(ctx)
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
+	// Source of values loaded on first access
+	p.source = fileSource(filename)
+	defer func() { p.source = nil }()
 
-	// Start in ExpLE mode for file metadata
-	reader := NewReader(file, binary.LittleEndian, true)
+	// Start in ExpLE mode for file metadata, changed if there is none
+	reader := p.fileReader(file)
+	return p.parsePart10(reader, func(ds *Dataset, r Reader) error {
+		return p.parseUntil(ds, r, maxTag)
+	})
+}
 
-	if err := p.checkHeader(reader); err != nil {
-		return nil, err
-	}
+// Parse a file held in the first size bytes of r, such as a MappedFile.
+// Skipped values are seeked over and lazily loaded values are read from r so
+// it must remain open until they are loaded.
+func (p *Parser) ParseReaderAt(r io.ReaderAt, size int64) (*Dataset, error) {
+	return p.ParseReaderAtContext(context.Background(), r, size)
+}
 
-	ds := NewDataset()
-	err = p.parseFileMeta(ds, reader)
-	if err != nil {
-		return nil, err
-	}
-	if err := p.checkXferSyntax(ds, reader); err != nil {
-		return nil, err
-	}
-	err = p.parseUntil(ds, reader, maxTag)
-	if err != nil {
-		return nil, err
-	}
+// ParseReaderAt checking ctx for cancellation between elements
+func (p *Parser) ParseReaderAtContext(ctx context.Context, r io.ReaderAt, size int64) (*Dataset, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.reset(ctx)
+	p.source = r
+	defer func() { p.source = nil }()
 
-	return ds, nil
+	reader := NewReaderAt(r, size, binary.LittleEndian, true)
+	return p.parsePart10(reader, p.parseAll)
 }
 
 func (p *Parser) ParseUntil(r io.Reader, explicit bool, maxTag uint32) (*Dataset, error) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
+	p.reset(context.Background())
 	ds := NewDataset()
 	reader := NewReader(r, binary.LittleEndian, explicit)
 	err := p.parseUntil(ds, reader, maxTag)
 	if err != nil {
-		return nil, err
+		return p.partialDataset(ds, reader, err)
 	}
 
 	return ds, nil
 }
 
-func (p *Parser) checkHeader(r Reader) error {
-	preamble := make([]byte, 128)
-	n, err := r.Read(preamble)
-	if n != len(preamble) {
-		return dcmerr.Errorf(dcmerr.ErrIO,
-			"error reading preamble at byte %v (%08x)", r.BytesRead(), r.BytesRead())
+// Problems recovered from during the last call in lenient mode
+func (p *Parser) Warnings() []Warning {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	warnings := make([]Warning, len(p.warnings))
+	copy(warnings, p.warnings)
+	return warnings
+}
+
+// A Reader for file in ExpLE mode, reusing the buffer from previous files
+func (p *Parser) fileReader(file *os.File) Reader {
+	if p.file == nil {
+		p.file = NewReadSeeker(file, binary.LittleEndian, true).(*reader)
+	} else {
+		p.file.reset(file, binary.LittleEndian, true)
+	}
+	return p.file
+}
+
+// Parse the header, file meta if present and then the body using parse
+func (p *Parser) parsePart10(reader Reader, parse func(*Dataset, Reader) error) (*Dataset, error) {
+	hasMeta, err := p.checkHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := NewDataset()
+	if hasMeta {
+		err = p.parseFileMeta(ds, reader)
+		if err != nil {
+			return p.partialDataset(ds, reader, err)
+		}
+		reader, err = p.checkXferSyntax(ds, reader)
+		if err != nil {
+			return nil, err
+		}
 	}
+	err = parse(ds, reader)
 	if err != nil {
-		return err
+		return p.partialDataset(ds, reader, err)
 	}
-	prefix := make([]byte, 4)
-	n, err = r.Read(prefix)
-	if n != len(prefix) || err != nil {
-		return err
+
+	return ds, nil
+}
+
+// Check for cancellation and the total bytes limit between elements
+func (p *Parser) checkContext(r Reader) error {
+	if err := p.ctx.Err(); err != nil {
+		return dcmerr.Errorf(dcmerr.ErrCancelled,
+			"parsing cancelled at byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
+	}
+	if p.opts.MaxBytes > 0 && r.BytesRead() > p.opts.MaxBytes {
+		return dcmerr.Errorf(dcmerr.ErrSizeLimit,
+			"read %v bytes, limit is %v", r.BytesRead(), p.opts.MaxBytes)
+	}
+	return nil
+}
+
+// Check for the preamble and magic, returns true if file meta follows. Files
+// without a preamble may be raw datasets, their encoding is detected from the
+// first element
+func (p *Parser) checkHeader(r Reader) (bool, error) {
+	peek, _ := r.Peek(preambleLength + len(magic))
+	switch {
+	case len(peek) == preambleLength+len(magic) && string(peek[preambleLength:]) == magic:
+		if err := r.Skip(int64(len(peek))); err != nil {
+			return false, err
+		}
+		return true, nil
+	case len(peek) >= len(magic) && string(peek[:len(magic)]) == magic:
+		// Magic without preamble
+		if err := r.Skip(int64(len(magic))); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	hasMeta, err := p.detectEncoding(r)
+	if err != nil && len(peek) == preambleLength+len(magic) {
+		// Long enough for a preamble and not a raw dataset so a corrupt magic
+		return false, dcmerr.Errorf(dcmerr.ErrBadMagic,
+			"bad magic %v at byte %v (%08x)", peek[preambleLength:], preambleLength, preambleLength)
+	}
+	return hasMeta, err
+}
+
+// Guess the byte order and explicit VR from the first element of a dataset
+// without a preamble, returns true if it is file meta which is always ExpLE
+func (p *Parser) detectEncoding(r Reader) (bool, error) {
+	peek, _ := r.Peek(8)
+	if len(peek) < 8 {
+		return false, dcmerr.Errorf(dcmerr.ErrBadMagic,
+			"no preamble and too short for an element at byte %v (%08x)", r.BytesRead(), r.BytesRead())
+	}
+	// Groups at the start of a dataset are small, a leading zero byte means BE
+	var order binary.ByteOrder = binary.LittleEndian
+	if peek[0] == 0 && peek[1] != 0 {
+		order = binary.BigEndian
+	}
+	tag32 := p.readTagBytes(order, peek[0:4])
+	explicit := vr.IsVR(string(peek[4:6]))
+	if tag32>>16 == 0x0002 {
+		return true, nil
+	}
+	// Command elements are never stored, this is also a zero preamble
+	if tag32>>16 == 0x0000 {
+		return false, dcmerr.Errorf(dcmerr.ErrBadMagic,
+			"no preamble and command element 0x%08x first", tag32)
+	}
+	// Without a VR to go on the tag must at least be known or a group length
+	if !explicit && tag.Name(tag32) == "UNKNOWN" && tag32&0xffff != 0 {
+		return false, dcmerr.Errorf(dcmerr.ErrBadMagic,
+			"no preamble and unrecognised first element 0x%08x", tag32)
+	}
+	r.SetByteOrder(order)
+	r.SetExplicit(explicit)
+	return false, nil
+}
+
+// Check a value length before any memory is allocated for it
+func (p *Parser) checkLength(r Reader, tag32, vl uint32) error {
+	if vl == UndefinedLength {
+		return nil
 	}
-	if string(prefix) != magic {
-		return dcmerr.Errorf(dcmerr.ErrIO,
-			"bad magic %v at byte %v (%08x)", prefix, r.BytesRead(), r.BytesRead())
+	if p.opts.MaxElementLength > 0 && vl > p.opts.MaxElementLength {
+		return dcmerr.Errorf(dcmerr.ErrLengthLimit,
+			"length %v of element 0x%08x at byte %v (%08x) exceeds limit %v",
+			vl, tag32, r.BytesRead(), r.BytesRead(), p.opts.MaxElementLength)
+	}
+	if p.opts.MaxBytes > 0 && r.BytesRead()+uint64(vl) > p.opts.MaxBytes {
+		return dcmerr.Errorf(dcmerr.ErrSizeLimit,
+			"length %v of element 0x%08x at byte %v (%08x) exceeds limit of %v bytes",
+			vl, tag32, r.BytesRead(), r.BytesRead(), p.opts.MaxBytes)
 	}
 	return nil
 }
@@ -173,7 +366,7 @@ func (p *Parser) checkSQMarker(tag uint32, r Reader) (*Element, error) {
 	switch tag {
 	case SQItem:
 		// SQItem can have a length or UndefinedLength
-		vl, err := r.ReadUint32LE()
+		vl, err := r.ReadUint32()
 		if err != nil {
 			return nil, err
 		}
@@ -211,7 +404,7 @@ func (p *Parser) checkSQMarkerPeek(tag uint32, r Reader) (*Element, error) {
 			return nil, err
 		}
 		// SQItem can have a length or UndefinedLength
-		vl, err := r.ReadUint32LE()
+		vl, err := r.ReadUint32()
 		if err != nil {
 			return nil, err
 		}
@@ -258,21 +451,57 @@ func (p *Parser) checkSQMarkerVL(tag, vl uint32) (*Element, error) {
 	return nil, nil
 }
 
-func (p *Parser) checkXferSyntax(ds *Dataset, r Reader) error {
+// Undefined length UN has been parsed as a sequence, optionally make it SQ
+func (p *Parser) checkUNSequence(vr string, value Value) string {
+	if vr != "UN" || !p.opts.RetypeUNSequences {
+		return vr
+	}
+	if _, ok := value.(*sqValue); ok {
+		return "SQ"
+	}
+	return vr
+}
+
+// Set up the reader for the dataset body after the file meta, a new reader is
+// returned for deflated TransferSyntaxes
+func (p *Parser) checkXferSyntax(ds *Dataset, r Reader) (Reader, error) {
 	tsuid, err := ds.GetString(tag.TransferSyntaxUID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if tsuid == uid.ImplicitVRLittleEndian {
-		r.SetExplicit(false)
+	order, explicit := xferSyntaxEncoding(tsuid)
+	if isDeflated(tsuid) {
+		// Byte offsets are relative to the start of the inflated body so
+		// values can't be loaded from the file later
+		p.source = nil
+		return NewReader(flate.NewReader(r), order, explicit), nil
+	}
+	r.SetByteOrder(order)
+	r.SetExplicit(explicit)
+	return r, nil
+}
+
+// Track sequence nesting against the depth limit
+func (p *Parser) enterSequence(r Reader) error {
+	p.depth++
+	if p.opts.MaxDepth > 0 && p.depth > p.opts.MaxDepth {
+		p.depth--
+		return dcmerr.Errorf(dcmerr.ErrDepthLimit,
+			"sequence at byte %v (%08x) exceeds nesting limit %v", r.BytesRead(), r.BytesRead(), p.opts.MaxDepth)
 	}
 	return nil
 }
 
+func (p *Parser) leaveSequence() {
+	p.depth--
+}
+
 func (p *Parser) parseAll(ds *Dataset, r Reader) error {
 	for {
 		elem, err := p.readElement(r)
 		if err != nil {
+			// Partial element returned with an error in lenient mode
+			ds.Put(elem)
 			if dcmerr.IsErrEOF(err) {
 				return nil
 			}
@@ -294,6 +523,8 @@ func (p *Parser) parseDatasetWithin(ds *Dataset, r Reader, length uint32) error
 		}
 		elem, err := p.readElement(r)
 		if err != nil {
+			// Partial element returned with an error in lenient mode
+			ds.Put(elem)
 			if dcmerr.IsErrEOF(err) {
 				return nil
 			}
@@ -310,7 +541,13 @@ func (p *Parser) parseFileMeta(ds *Dataset, r Reader) error {
 		return err
 	}
 	ds.Put(metaLen)
-	maxRead := start + uint64(metaLen.Value.Get().(uint32))
+	groupLen, ok := metaLen.Value.Get().(uint32)
+	if !ok {
+		return dcmerr.Errorf(dcmerr.ErrNotConvertible,
+			"error near byte %v (%08x) - invalid file meta group length %v",
+			start, start, metaLen)
+	}
+	maxRead := start + uint64(groupLen)
 	for r.BytesRead() < maxRead {
 		elem, err := p.readElement(r)
 		if err != nil {
@@ -321,10 +558,39 @@ func (p *Parser) parseFileMeta(ds *Dataset, r Reader) error {
 	return nil
 }
 
+// Parse an undefined length item up to SQItemDelim and return the marker that
+// ended it, in lenient mode a missing SQItemDelim is recovered from when the
+// next SQItem or SQDelim is found instead
+func (p *Parser) parseItem(ds *Dataset, r Reader) (*Element, error) {
+	for {
+		pos := r.BytesRead()
+		elem, err := p.readElement(r)
+		if err != nil {
+			// Partial element returned with an error in lenient mode
+			ds.Put(elem)
+			return nil, err
+		}
+		switch elem.Tag {
+		case SQItemDelim:
+			return elem, nil
+		case SQItem, SQDelim:
+			if !p.opts.Lenient {
+				return nil, dcmerr.Errorf(dcmerr.ErrIO,
+					"SQItemDelim tag expected at %v (%08x), found %08x", pos, pos, elem.Tag)
+			}
+			p.warn(pos, elem.Tag, "missing SQItemDelim")
+			return elem, nil
+		}
+		ds.Put(elem)
+	}
+}
+
 func (p *Parser) parseUntil(ds *Dataset, r Reader, maxTag uint32) error {
 	for {
 		elem, err := p.readElementPeek(r, maxTag)
 		if err != nil {
+			// Partial element returned with an error in lenient mode
+			ds.Put(elem)
 			if dcmerr.IsErrEOF(err) {
 				return nil
 			}
@@ -342,17 +608,93 @@ func (p *Parser) parseUntil(ds *Dataset, r Reader, maxTag uint32) error {
 	}
 }
 
+// Keep the partial dataset in lenient mode, with the error as a warning
+func (p *Parser) partialDataset(ds *Dataset, r Reader, err error) (*Dataset, error) {
+	if !p.opts.Lenient || isLimitError(err) {
+		return nil, err
+	}
+	p.warn(r.BytesRead(), 0, "parsing stopped - %v", err.Error())
+	return ds, nil
+}
+
+// Keep the items read so far in lenient mode, returned with the error
+func (p *Parser) partialSequence(items []*Dataset, err error) (Value, error) {
+	if !p.opts.Lenient && !p.stopped {
+		return nil, err
+	}
+	// Dataset slice can't create errors
+	value, _ := NewValue(items)
+	return value, err
+}
+
+// Empty items are dropped, including those cut short by an error
+func appendItem(items []*Dataset, ds *Dataset) []*Dataset {
+	if ds.Size() == 0 {
+		return items
+	}
+	return append(items, ds)
+}
+
+// Read AT values as pairs of 16 bit group and element
+func (p *Parser) readAttributeTagValue(r Reader, vl uint32) (Value, error) {
+	buf, err := readScratch(r, vl, p.opts.Lenient)
+	if buf == nil {
+		return nil, err
+	}
+	defer putScratch(buf)
+	// Numeric slices can't create errors
+	value, _ := NewValue(decodeAttributeTags(r.ByteOrder(), *buf))
+	return value, err
+}
+
 func (p *Parser) readBytesValue(r Reader, vl uint32) (Value, error) {
 	buf := make([]byte, vl)
 	n, err := io.ReadFull(r, buf)
 	if uint32(n) < vl {
+		if p.opts.Lenient && n > 0 {
+			// Keep the bytes of a truncated value
+			value, _ := NewValue(buf[:n])
+			return value, err
+		}
 		return nil, err
 	}
 	return NewValue(buf)
 }
 
 func (p *Parser) readElement(r Reader) (*Element, error) {
-	tag32, err := p.readLETag(r)
+	for {
+		elem, err := p.readElementHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		// SQ markers have no value
+		if elem.Value != nil {
+			return elem, nil
+		}
+		if p.stop != nil && p.stop(p.path, elem) {
+			// Send ErrEOF to simulate the end of the stream
+			p.stopped = true
+			return nil, dcmerr.NewErrEOF()
+		}
+		if p.isExcluded(elem) {
+			if err := p.skipValue(r, elem); err != nil {
+				return nil, dcmerr.Errorf(dcmerr.ErrIO,
+					"error near byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
+			}
+			continue
+		}
+		return p.readElementValue(r, elem)
+	}
+}
+
+// Read the tag, VR and VL of an element leaving the value unread, SQ markers
+// are returned complete with an empty value
+func (p *Parser) readElementHeader(r Reader) (*Element, error) {
+	if err := p.checkContext(r); err != nil {
+		return nil, err
+	}
+	pos := r.BytesRead()
+	tag32, err := p.readTag(r)
 	if err != nil {
 		return nil, err
 	}
@@ -366,80 +708,119 @@ func (p *Parser) readElement(r Reader) (*Element, error) {
 		return sqMarker, err
 	}
 
-	vr, err := p.readVR(r, tag32)
+	encodedVR := p.peekVR(r)
+	vrStr, vl, err := p.readVRVL(r, tag32)
 	if err != nil {
 		return nil, err
 	}
-	vl, err := p.readVL(r, vr)
-	if err != nil {
-		return nil, dcmerr.Errorf(dcmerr.ErrIO,
-			"error near byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
-	}
-	value, err := p.readValue(r, vr, vl)
-	if err != nil {
-		return nil, dcmerr.Errorf(dcmerr.ErrIO,
-			"error near byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
-	}
-
-	return NewElement(tag32, vr, vl, value), nil
+	elem := NewElement(tag32, vrStr, vl, nil)
+	p.setSource(elem, r, pos, encodedVR)
+	return elem, nil
 }
 
 func (p *Parser) readElementPeek(r Reader, maxTag uint32) (*Element, error) {
-	peek, err := r.Peek(4)
-	if err != nil {
-		if err == io.EOF {
+	for {
+		if err := p.checkContext(r); err != nil {
+			return nil, err
+		}
+		pos := r.BytesRead()
+		peek, err := r.Peek(4)
+		if err != nil {
+			if err == io.EOF {
+				return nil, dcmerr.NewErrEOF()
+			}
+			return nil, dcmerr.Errorf(dcmerr.ErrIO,
+				"error peeking at byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
+		}
+		tag32 := p.readTagBytes(r.ByteOrder(), peek[0:4])
+		if tag32 > maxTag {
+			// Send ErrEOF to simulate the end of the stream
 			return nil, dcmerr.NewErrEOF()
 		}
-		return nil, dcmerr.Errorf(dcmerr.ErrIO,
-			"error peeking at byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
-	}
-	tag32 := p.readLETagBytes(peek[0:4])
-	if tag32 > maxTag {
-		// Send ErrEOF to simulate the end of the stream
-		return nil, dcmerr.NewErrEOF()
+		// Short circuit on SQ markers
+		sqMarker, err := p.checkSQMarkerPeek(tag32, r)
+		if err != nil {
+			return nil, dcmerr.Errorf(dcmerr.ErrIO,
+				"error near byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
+		}
+		if sqMarker != nil {
+			return sqMarker, err
+		}
+
+		// Skip the 4 peeked bytes
+		if err := r.Skip(4); err != nil {
+			return nil,
+				dcmerr.Errorf(dcmerr.ErrIO,
+					"error skipping ahead at byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
+		}
+
+		encodedVR := p.peekVR(r)
+		vrStr, vl, err := p.readVRVL(r, tag32)
+		if err != nil {
+			return nil, err
+		}
+		elem := NewElement(tag32, vrStr, vl, nil)
+		p.setSource(elem, r, pos, encodedVR)
+		if p.isExcluded(elem) {
+			if err := p.skipValue(r, elem); err != nil {
+				return nil, dcmerr.Errorf(dcmerr.ErrIO,
+					"error near byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
+			}
+			continue
+		}
+		return p.readElementValue(r, elem)
 	}
-	// Short circuit on SQ markers
-	sqMarker, err := p.checkSQMarkerPeek(tag32, r)
-	if err != nil {
-		return nil, dcmerr.Errorf(dcmerr.ErrIO,
-			"error near byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
+}
+
+// Read the value of an element following its header, in lenient mode an
+// element with a partial value may be returned with an error
+func (p *Parser) readElementValue(r Reader, elem *Element) (*Element, error) {
+	if p.isLazy(elem) {
+		return p.readLazyValue(r, elem)
 	}
-	if sqMarker != nil {
-		return sqMarker, err
+	if p.stop != nil {
+		p.path = append(p.path, elem.Tag)
 	}
-
-	// Skip the 4 peeked bytes
-	if err := r.Skip(4); err != nil {
-		return nil,
-			dcmerr.Errorf(dcmerr.ErrIO,
-				"error skipping ahead at byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
+	value, err := p.readValue(r, elem.VR, elem.VL)
+	if p.stop != nil {
+		p.path = p.path[:len(p.path)-1]
 	}
-
-	vr, err := p.readVR(r, tag32)
-	if err != nil {
-		return nil, err
+	if err != nil && p.stopped {
+		// Keep the part of the value read before stopping
+		elem.Value = value
+		return elem, err
 	}
-	vl, err := p.readVL(r, vr)
 	if err != nil {
-		return nil, dcmerr.Errorf(dcmerr.ErrIO,
+		// Limit errors keep their code to be distinguishable by the caller
+		code := dcmerr.ErrIO
+		if isLimitError(err) {
+			code = err.(dcmerr.DicomError).Code()
+		}
+		err = dcmerr.Errorf(code,
 			"error near byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
+		// Partial value is only returned in lenient mode
+		if value != nil {
+			p.warn(r.BytesRead(), elem.Tag, "partial value kept - %v", err.Error())
+			elem.Value = value
+			return elem, err
+		}
+		return nil, err
 	}
-	value, err := p.readValue(r, vr, vl)
-	if err != nil {
-		return nil, dcmerr.Errorf(dcmerr.ErrIO,
-			"error near byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
+	elem.Value = value
+	elem.VR = p.checkUNSequence(elem.VR, value)
+	if elem.Tag == tag.SpecificCharacterSet {
+		p.setCharset(r, elem)
 	}
-
-	return NewElement(tag32, vr, vl, value), nil
+	return elem, nil
 }
 
-// Read an element in ImpLE format regardless of TransferSyntax e.g. SQ items
-func (p *Parser) readImpLEElement(r Reader) (*Element, error) {
-	tag32, err := p.readLETag(r)
+// Read an element in implicit VR format regardless of TransferSyntax e.g. SQ items
+func (p *Parser) readImplicitElement(r Reader) (*Element, error) {
+	tag32, err := p.readTag(r)
 	if err != nil {
 		return nil, err
 	}
-	vl, err := r.ReadUint32LE()
+	vl, err := r.ReadUint32()
 	if err != nil {
 		return nil, dcmerr.Errorf(dcmerr.ErrIO,
 			"error near byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
@@ -454,159 +835,291 @@ func (p *Parser) readImpLEElement(r Reader) (*Element, error) {
 		return sqMarker, err
 	}
 
+	if err := p.checkLength(r, tag32, vl); err != nil {
+		return nil, err
+	}
 	vr := tag.VR(tag32)
 	value, err := p.readValue(r, vr, vl)
 	if err != nil {
 		return nil, dcmerr.Errorf(dcmerr.ErrIO,
 			"error near byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
 	}
+	vr = p.checkUNSequence(vr, value)
 
 	return NewElement(tag32, vr, vl, value), nil
 }
 
-func (p *Parser) readFloat32Value(r Reader, vl uint32) (Value, error) {
-	data := make([]float32, vl/4)
-	for i := range data {
-		v, err := r.ReadFloat32()
+// Read encapsulated pixel data, a sequence of items where the first is the
+// Basic Offset Table and the rest are fragments, terminated by SQDelim
+func (p *Parser) readEncapsulated(r Reader) (Value, error) {
+	pixels := EncapsulatedPixelData{Fragments: make([][]byte, 0)}
+	first := true
+	for {
+		pos := r.BytesRead()
+		tag32, err := p.readTag(r)
 		if err != nil {
 			return nil, err
 		}
-		data[i] = v
-	}
-	return NewValue(data)
-}
-
-func (p *Parser) readFloat64Value(r Reader, vl uint32) (Value, error) {
-	data := make([]float64, vl/8)
-	for i := range data {
-		v, err := r.ReadFloat64()
+		vl, err := r.ReadUint32()
 		if err != nil {
 			return nil, err
 		}
-		data[i] = v
+		if tag32 == SQDelim {
+			break
+		}
+		if tag32 != SQItem {
+			return nil, dcmerr.Errorf(dcmerr.ErrIO,
+				"SQItem tag expected at %v (%08x), found %08x", pos, pos, tag32)
+		}
+		if vl == UndefinedLength {
+			return nil, dcmerr.Errorf(dcmerr.ErrIO,
+				"undefined length fragment at %v (%08x)", pos, pos)
+		}
+		if err := p.checkLength(r, tag32, vl); err != nil {
+			return nil, err
+		}
+		if first {
+			first = false
+			offsets := make([]uint32, vl/4)
+			for i := range offsets {
+				v, err := r.ReadUint32()
+				if err != nil {
+					return nil, err
+				}
+				offsets[i] = v
+			}
+			pixels.BasicOffsetTable = offsets
+			continue
+		}
+		frag := make([]byte, vl)
+		if _, err := io.ReadFull(r, frag); err != nil {
+			return nil, dcmerr.Errorf(dcmerr.ErrUnexpectedEOF,
+				"error reading fragment at %v (%08x) - %v", pos, pos, err.Error())
+		}
+		pixels.Fragments = append(pixels.Fragments, frag)
 	}
-	return NewValue(data)
+	return NewValue(&pixels)
 }
 
-func (p *Parser) readInt16Value(r Reader, vl uint32) (Value, error) {
-	data := make([]int16, vl/2)
-	for i := range data {
-		v, err := r.ReadInt16()
-		if err != nil {
-			return nil, err
-		}
-		data[i] = v
+func (p *Parser) readFloat32Value(r Reader, vl uint32) (Value, error) {
+	buf, err := readScratch(r, vl, p.opts.Lenient)
+	if buf == nil {
+		return nil, err
 	}
-	return NewValue(data)
+	defer putScratch(buf)
+	// Numeric slices can't create errors
+	value, _ := NewValue(decodeFloat32s(r.ByteOrder(), *buf))
+	return value, err
 }
 
-func (p *Parser) readInt32Value(r Reader, vl uint32) (Value, error) {
-	data := make([]int32, vl/4)
-	for i := range data {
-		v, err := r.ReadInt32()
-		if err != nil {
-			return nil, err
-		}
-		data[i] = v
+func (p *Parser) readFloat64Value(r Reader, vl uint32) (Value, error) {
+	buf, err := readScratch(r, vl, p.opts.Lenient)
+	if buf == nil {
+		return nil, err
 	}
-	return NewValue(data)
+	defer putScratch(buf)
+	// Numeric slices can't create errors
+	value, _ := NewValue(decodeFloat64s(r.ByteOrder(), *buf))
+	return value, err
 }
 
-// Read a tag in LE ordering regardless of the TransferSyntax e.g. SQ items
-func (p *Parser) readLETag(r Reader) (uint32, error) {
-	g, err := r.ReadUint16LE()
-	if err != nil {
-		return 0, err
+func (p *Parser) readImpLESequence(r Reader) (Value, error) {
+	order, explicit := r.ByteOrder(), r.IsExplicit()
+	r.SetByteOrder(binary.LittleEndian)
+	r.SetExplicit(false)
+	value, err := p.readSequence(r, UndefinedLength)
+	r.SetByteOrder(order)
+	r.SetExplicit(explicit)
+	return value, err
+}
+
+func (p *Parser) readInt16Value(r Reader, vl uint32) (Value, error) {
+	buf, err := readScratch(r, vl, p.opts.Lenient)
+	if buf == nil {
+		return nil, err
 	}
-	e, err := r.ReadUint16LE()
-	if err != nil {
-		// EOF should not happen except at the beginning of a tag
-		if dcmerr.IsErrEOF(err) {
-			return 0, dcmerr.Errorf(dcmerr.ErrUnexpectedEOF,
-				"error near byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
-		}
-		return 0, err
+	defer putScratch(buf)
+	// Numeric slices can't create errors
+	value, _ := NewValue(decodeInt16s(r.ByteOrder(), *buf))
+	return value, err
+}
+
+func (p *Parser) readInt32Value(r Reader, vl uint32) (Value, error) {
+	buf, err := readScratch(r, vl, p.opts.Lenient)
+	if buf == nil {
+		return nil, err
 	}
-	return uint32(g)<<16 | uint32(e), nil
+	defer putScratch(buf)
+	// Numeric slices can't create errors
+	value, _ := NewValue(decodeInt32s(r.ByteOrder(), *buf))
+	return value, err
 }
 
-func (p *Parser) readLETagBytes(b []byte) uint32 {
-	return uint32(b[0])<<16 | uint32(b[1])<<24 | uint32(b[2]) | uint32(b[3])<<8
+func (p *Parser) readInt64Value(r Reader, vl uint32) (Value, error) {
+	buf, err := readScratch(r, vl, p.opts.Lenient)
+	if buf == nil {
+		return nil, err
+	}
+	defer putScratch(buf)
+	// Numeric slices can't create errors
+	value, _ := NewValue(decodeInt64s(r.ByteOrder(), *buf))
+	return value, err
 }
 
-func (p *Parser) readSequence(r Reader) (Value, error) {
+func (p *Parser) readSequence(r Reader, vl uint32) (Value, error) {
+	if err := p.enterSequence(r); err != nil {
+		return nil, err
+	}
+	defer p.leaveSequence()
+	// Items inherit the character set unless they specify their own
+	parent := p.charset
+	defer func() { p.charset = parent }()
+	limit := r.BytesRead() + uint64(vl)
 	items := make([]*Dataset, 0)
+	// SQItem already read when recovering from a missing SQItemDelim
+	var next *Element
 	for {
+		if p.stopped {
+			return p.partialSequence(items, dcmerr.NewErrEOF())
+		}
+		// Defined length SQ has no SQDelim, bail at the end of the value
+		if vl != UndefinedLength && r.BytesRead() >= limit {
+			break
+		}
 		pos := r.BytesRead()
-		elem, err := p.readImpLEElement(r)
-		if err != nil {
-			return nil, err
+		elem := next
+		next = nil
+		if elem == nil {
+			var err error
+			elem, err = p.readImplicitElement(r)
+			if err != nil {
+				return p.partialSequence(items, err)
+			}
 		}
 		// Bail if the end of the SQ
 		if elem.Tag == SQDelim {
 			break
 		}
 		if elem.Tag != SQItem {
-			return nil, dcmerr.Errorf(dcmerr.ErrIO,
-				"SQItem tag expected at %v (%08x), found %08x", pos, pos, elem.Tag)
+			return p.partialSequence(items, dcmerr.Errorf(dcmerr.ErrIO,
+				"SQItem tag expected at %v (%08x), found %08x", pos, pos, elem.Tag))
 		}
+		p.charset = parent
 		ds := NewDataset()
+		if p.opts.KeepSource {
+			ds.source = &SourceInfo{
+				Offset:          pos,
+				HeaderLength:    8,
+				UndefinedLength: elem.VL == UndefinedLength,
+			}
+		}
 		if elem.VL == UndefinedLength {
 			// Undefined length item will end with SQItemDelim
-			if err := p.parseAll(ds, r); err != nil {
-				return nil, err
+			end, err := p.parseItem(ds, r)
+			if err != nil {
+				return p.partialSequence(appendItem(items, ds), err)
+			}
+			switch end.Tag {
+			case SQItem:
+				next = end
+			case SQDelim:
+				return NewValue(appendItem(items, ds))
 			}
 		} else {
 			// Defined length item, parse at most VL bytes
 			if err := p.parseDatasetWithin(ds, r, elem.VL); err != nil {
-				return nil, err
+				return p.partialSequence(appendItem(items, ds), err)
 			}
 		}
-		// Add the Dataset if it's not empty
-		if ds.Size() > 0 {
-			items = append(items, ds)
-		}
+		items = appendItem(items, ds)
 	}
 	return NewValue(items)
 }
 
-func (p *Parser) readStringValue(r Reader, vl uint32) (Value, error) {
+func (p *Parser) readStringValue(r Reader, vr string, vl uint32) (Value, error) {
 	s, err := r.ReadString(vl)
 	if err != nil {
 		return nil, err
 	}
-	return NewValue(s)
+	return newStringValue(vr, s), nil
 }
 
-func (p *Parser) readUint16Value(r Reader, vl uint32) (Value, error) {
-	data := make([]uint16, vl/2)
-	for i := range data {
-		v, err := r.ReadUint16()
-		if err != nil {
-			return nil, err
+func (p *Parser) readTag(r Reader) (uint32, error) {
+	g, err := r.ReadUint16()
+	if err != nil {
+		return 0, err
+	}
+	e, err := r.ReadUint16()
+	if err != nil {
+		// EOF should not happen except at the beginning of a tag
+		if dcmerr.IsErrEOF(err) {
+			return 0, dcmerr.Errorf(dcmerr.ErrUnexpectedEOF,
+				"error near byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
 		}
-		data[i] = v
+		return 0, err
 	}
-	return NewValue(data)
+	return uint32(g)<<16 | uint32(e), nil
+}
+
+func (p *Parser) readTagBytes(order binary.ByteOrder, b []byte) uint32 {
+	return uint32(order.Uint16(b[0:2]))<<16 | uint32(order.Uint16(b[2:4]))
+}
+
+func (p *Parser) readTextValue(r Reader, vr string, vl uint32) (Value, error) {
+	s, err := r.ReadString(vl)
+	if err != nil {
+		return nil, err
+	}
+	if p.charset != nil {
+		s = p.charset.decode([]byte(s))
+	}
+	return newStringValue(vr, s), nil
+}
+
+func (p *Parser) readUint16Value(r Reader, vl uint32) (Value, error) {
+	buf, err := readScratch(r, vl, p.opts.Lenient)
+	if buf == nil {
+		return nil, err
+	}
+	defer putScratch(buf)
+	// Numeric slices can't create errors
+	value, _ := NewValue(decodeUint16s(r.ByteOrder(), *buf))
+	return value, err
 }
 
 func (p *Parser) readUint32Value(r Reader, vl uint32) (Value, error) {
-	data := make([]uint32, vl/4)
-	for i := range data {
-		v, err := r.ReadUint32()
-		if err != nil {
-			return nil, err
-		}
-		data[i] = v
+	buf, err := readScratch(r, vl, p.opts.Lenient)
+	if buf == nil {
+		return nil, err
+	}
+	defer putScratch(buf)
+	// Numeric slices can't create errors
+	value, _ := NewValue(decodeUint32s(r.ByteOrder(), *buf))
+	return value, err
+}
+
+func (p *Parser) readUint64Value(r Reader, vl uint32) (Value, error) {
+	buf, err := readScratch(r, vl, p.opts.Lenient)
+	if buf == nil {
+		return nil, err
 	}
-	return NewValue(data)
+	defer putScratch(buf)
+	// Numeric slices can't create errors
+	value, _ := NewValue(decodeUint64s(r.ByteOrder(), *buf))
+	return value, err
 }
 
 func (p *Parser) readUndefLenValue(r Reader, vr string) (Value, error) {
 	switch vr {
 	case "SQ":
 		// fmt.Printf("SQ found at %v (%08x)\n", r.BytesRead()-8, r.BytesRead()-8)
-		return p.readSequence(r)
+		return p.readSequence(r, UndefinedLength)
+	// Undefined length UN is a sequence encoded in ImpLE regardless of TransferSyntax
+	case "UN":
+		return p.readImpLESequence(r)
+	// Undefined length pixel data is encapsulated in a compressed TransferSyntax
+	case "OB", "OW", "ox", "px":
+		return p.readEncapsulated(r)
 	}
 	return nil, dcmerr.Errorf(dcmerr.ErrIO, "undefined length for VR %v", vr)
 }
@@ -616,10 +1129,12 @@ func (p *Parser) readValue(r Reader, vr string, vl uint32) (Value, error) {
 		return p.readUndefLenValue(r, vr)
 	}
 	switch vr {
-	case "AE", "AS", "CS", "DA", "DS", "DT", "IS", "LO", "LT", "PN", "SH", "ST",
-		"TM", "UI":
-		return p.readStringValue(r, vl)
-	case "UL":
+	case "AE", "AS", "CS", "DA", "DS", "DT", "IS", "TM", "UI", "UR":
+		return p.readStringValue(r, vr, vl)
+	// Decoded according to SpecificCharacterSet
+	case "LO", "LT", "PN", "SH", "ST", "UC", "UT":
+		return p.readTextValue(r, vr, vl)
+	case "UL", "OL":
 		return p.readUint32Value(r, vl)
 	// "xs" (from dcmtk.dic) means "either US or SS", read as US - it can be converted if required later
 	case "US", "xs":
@@ -627,16 +1142,22 @@ func (p *Parser) readValue(r Reader, vr string, vl uint32) (Value, error) {
 	// "ox", "px" (from dcmtk.dic) mean "either OB or OW", read as OB - it can be converted if required later
 	case "OB", "UN", "ox", "px":
 		return p.readBytesValue(r, vl)
-	// case "AT":
-	// 	use16 = true
-	case "FL":
+	case "AT":
+		return p.readAttributeTagValue(r, vl)
+	case "FL", "OF":
 		return p.readFloat32Value(r, vl)
-	case "FD":
+	case "FD", "OD":
 		return p.readFloat64Value(r, vl)
 	case "SL":
 		return p.readInt32Value(r, vl)
+	case "SV":
+		return p.readInt64Value(r, vl)
 	case "SS", "OW":
 		return p.readInt16Value(r, vl)
+	case "OV", "UV":
+		return p.readUint64Value(r, vl)
+	case "SQ":
+		return p.readSequence(r, vl)
 	default:
 		return nil, dcmerr.Errorf(dcmerr.ErrIO, "unsupported VR: %v", vr)
 	}
@@ -646,13 +1167,7 @@ func (p *Parser) readVL(r Reader, vr string) (uint32, error) {
 	if !r.IsExplicit() {
 		return r.ReadUint32()
 	}
-	var use16 bool
-	switch vr {
-	case "AE", "AS", "AT", "CS", "DA", "DS", "DT", "FL", "FD", "IS", "LO",
-		"LT", "PN", "SH", "SL", "SS", "ST", "TM", "UI", "UL", "US":
-		use16 = true
-	}
-	if use16 {
+	if useShortVL(vr) {
 		vl16, err := r.ReadUint16()
 		if err != nil {
 			return 0, err
@@ -669,9 +1184,133 @@ func (p *Parser) readVL(r Reader, vr string) (uint32, error) {
 	return vl, nil
 }
 
+// Read the VR and VL of an element, in lenient mode an element without a
+// valid VR in an explicit VR stream is read as implicit VR
+func (p *Parser) readVRVL(r Reader, tag32 uint32) (string, uint32, error) {
+	var vrStr string
+	var vl uint32
+	var err error
+	peek, _ := r.Peek(2)
+	if p.opts.Lenient && r.IsExplicit() && len(peek) == 2 && !vr.IsVR(string(peek)) {
+		p.warn(r.BytesRead(), tag32, "invalid VR %q, read as implicit VR", peek)
+		vrStr = tag.VR(tag32)
+		vl, err = r.ReadUint32()
+	} else {
+		vrStr, err = p.readVR(r, tag32)
+		if err != nil {
+			return "", 0, err
+		}
+		vl, err = p.readVL(r, vrStr)
+	}
+	if err != nil {
+		return "", 0, dcmerr.Errorf(dcmerr.ErrIO,
+			"error near byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
+	}
+	if err := p.checkLength(r, tag32, vl); err != nil {
+		return "", 0, err
+	}
+	if p.opts.Lenient && vl != UndefinedLength && vl%2 != 0 {
+		p.warn(r.BytesRead(), tag32, "odd length %v", vl)
+	}
+	return vrStr, vl, nil
+}
+
 func (p *Parser) readVR(r Reader, tag32 uint32) (string, error) {
 	if !r.IsExplicit() {
 		return tag.VR(tag32), nil
 	}
 	return r.ReadString(2)
 }
+
+// The VR about to be read, empty if implicit or not a valid VR. Only needed
+// with KeepSource.
+func (p *Parser) peekVR(r Reader) string {
+	if !p.opts.KeepSource || !r.IsExplicit() {
+		return ""
+	}
+	peek, err := r.Peek(2)
+	if err != nil || !vr.IsVR(string(peek)) {
+		return ""
+	}
+	return string(peek)
+}
+
+// Record the header of elem read from pos
+func (p *Parser) setSource(elem *Element, r Reader, pos uint64, encodedVR string) {
+	if !p.opts.KeepSource {
+		return
+	}
+	elem.Source = &SourceInfo{
+		Offset:          pos,
+		HeaderLength:    uint32(r.BytesRead() - pos),
+		VR:              encodedVR,
+		UndefinedLength: elem.VL == UndefinedLength,
+	}
+}
+
+// Decode text values that follow using the character set of elem, values
+// are left undecoded if it is not recognised
+func (p *Parser) setCharset(r Reader, elem *Element) {
+	value := elem.Value.String()
+	cs, ok := newCharset(value)
+	if !ok && p.opts.Lenient {
+		p.warn(r.BytesRead(), elem.Tag, "unsupported SpecificCharacterSet %q", value)
+	}
+	p.charset = cs
+}
+
+// Reset the state for a new call
+func (p *Parser) reset(ctx context.Context) {
+	p.ctx = ctx
+	p.depth = 0
+	p.stop = nil
+	p.stopped = false
+	p.path = nil
+	p.charset = nil
+	p.warnings = nil
+}
+
+func (p *Parser) warn(offset uint64, tag32 uint32, format string, a ...any) {
+	p.warnings = append(p.warnings, Warning{
+		Offset:  offset,
+		Tag:     tag32,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+func isLimitError(err error) bool {
+	return dcmerr.IsErrCancelled(err) || dcmerr.IsErrLengthLimit(err) ||
+		dcmerr.IsErrDepthLimit(err) || dcmerr.IsErrSizeLimit(err)
+}
+
+// The dataset body after the file meta is compressed with raw deflate
+func isDeflated(tsuid string) bool {
+	switch tsuid {
+	case uid.DeflatedExplicitVRLittleEndian, uid.JPIPReferencedDeflate:
+		return true
+	}
+	return false
+}
+
+// Byte order and explicit VR of the dataset body for a TransferSyntaxUID, the
+// file meta is always ExpLE
+func xferSyntaxEncoding(tsuid string) (binary.ByteOrder, bool) {
+	switch tsuid {
+	case uid.ImplicitVRLittleEndian, uid.Papyrus3ImplicitVRLittleEndian:
+		return binary.LittleEndian, false
+	case uid.ExplicitVRBigEndian:
+		return binary.BigEndian, true
+	}
+	return binary.LittleEndian, true
+}
+
+// In explicit VR these VRs have a 16 bit length, all others have 2 reserved
+// bytes followed by a 32 bit length
+func useShortVL(vr string) bool {
+	switch vr {
+	case "AE", "AS", "AT", "CS", "DA", "DS", "DT", "FL", "FD", "IS", "LO",
+		"LT", "PN", "SH", "SL", "SS", "ST", "TM", "UI", "UL", "US":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
+	"github.com/JamesDarcy616/dicom/uid"
+)
+
+func TestParseStrayItemDelimiter(t *testing.T) {
+	data := explicitElement(binary.LittleEndian, tag.PatientName, "PN", []byte("Doe^John"))
+	data = append(data, 0xfe, 0xff, 0x0d, 0xe0, 0, 0, 0, 0)
+	for _, lenient := range []bool{false, true} {
+		ds, err := NewParserWithOptions(ParseOptions{Lenient: lenient}).Parse(bytes.NewReader(data), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ds.Get(SQItemDelim); err == nil {
+			t.Errorf("lenient %v: SQItemDelim stored in the dataset", lenient)
+		}
+		if ds.Size() != 1 {
+			t.Errorf("lenient %v: %v elements, want 1\n%v", lenient, ds.Size(), ds)
+		}
+	}
+}
+
+func TestParseFileBadMagic(t *testing.T) {
+	ds := NewDataset()
+	ds.Put(testElement(t, tag.PatientName, "PN", "Doe^John"))
+	data, err := os.ReadFile(testFile(t, ds, uid.ExplicitVRLittleEndian))
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(data[preambleLength:], "DICX")
+	filename := filepath.Join(t.TempDir(), "bad.dcm")
+	if err := os.WriteFile(filename, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, lenient := range []bool{false, true} {
+		_, err := NewParserWithOptions(ParseOptions{Lenient: lenient}).ParseFile(filename)
+		if !dcmerr.IsErrBadMagic(err) {
+			t.Errorf("lenient %v: got %v, want ErrBadMagic", lenient, err)
+		}
+	}
+}
+
+func TestParseFileRawDataset(t *testing.T) {
+	ds := NewDataset()
+	ds.Put(testElement(t, tag.StudyDescription, "LO", strings.Repeat("Study ", 20)))
+	ds.Put(testElement(t, tag.PatientName, "PN", "Doe^John"))
+	for _, explicit := range []bool{true, false} {
+		var buf bytes.Buffer
+		if err := Write(&buf, ds, explicit); err != nil {
+			t.Fatal(err)
+		}
+		filename := filepath.Join(t.TempDir(), "raw.dcm")
+		if err := os.WriteFile(filename, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		out, err := NewParser().ParseFile(filename)
+		if err != nil {
+			t.Fatalf("explicit %v: %v", explicit, err)
+		}
+		if name, _ := out.GetString(tag.PatientName); name != "Doe^John" {
+			t.Errorf("explicit %v: PatientName %q", explicit, name)
+		}
+	}
+}
+
+func TestParseFileRawDatasetGroup0010(t *testing.T) {
+	ds := NewDataset()
+	ds.Put(testElement(t, tag.PatientName, "PN", "Doe^John"))
+	ds.Put(testElement(t, tag.PatientID, "LO", "ID1"))
+	ds.Put(testElement(t, tag.PatientComments, "LT", strings.Repeat("Comment ", 25)))
+	for _, explicit := range []bool{true, false} {
+		var buf bytes.Buffer
+		if err := Write(&buf, ds, explicit); err != nil {
+			t.Fatal(err)
+		}
+		filename := filepath.Join(t.TempDir(), "raw.dcm")
+		if err := os.WriteFile(filename, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		out, err := NewParser().ParseFile(filename)
+		if err != nil {
+			t.Fatalf("explicit %v: %v", explicit, err)
+		}
+		if id, _ := out.GetString(tag.PatientID); id != "ID1" {
+			t.Errorf("explicit %v: PatientID %q", explicit, id)
+		}
+	}
+}
+
+// Lenient parses of streams cut off part way through the last element, which
+// is kept with its whole values
+func TestParseTruncatedNumeric(t *testing.T) {
+	le := binary.LittleEndian
+	fd := make([]byte, 24)
+	le.PutUint64(fd, math.Float64bits(1.5))
+	le.PutUint64(fd[8:], math.Float64bits(-2.25))
+	name := explicitElement(le, tag.PatientName, "PN", []byte("Doe^John"))
+	for _, c := range []struct {
+		name string
+		data []byte
+		tag  uint32
+		want interface{}
+	}{
+		{"FD", append(name, explicitElement(le, tag.TimeRange, "FD", fd)[:8+20]...),
+			tag.TimeRange, []float64{1.5, -2.25}},
+		{"US", append(name, explicitElement(le, tag.Rows, "US", []byte{1, 0, 2, 0, 3, 0})[:8+3]...),
+			tag.Rows, []uint16{1}},
+	} {
+		_, err := NewParser().Parse(bytes.NewReader(c.data), true)
+		if err == nil {
+			t.Errorf("%v: strict parse of truncated value", c.name)
+		}
+		p := NewParserWithOptions(ParseOptions{Lenient: true})
+		ds, err := p.Parse(bytes.NewReader(c.data), true)
+		if err != nil {
+			t.Fatalf("%v: %v", c.name, err)
+		}
+		elem, err := ds.Get(c.tag)
+		if err != nil {
+			t.Errorf("%v: truncated element dropped", c.name)
+			continue
+		}
+		if !reflect.DeepEqual(elem.Value.GetAll(), c.want) {
+			t.Errorf("%v: %v, want %v", c.name, elem.Value.GetAll(), c.want)
+		}
+		if _, err := ds.Get(tag.PatientName); err != nil {
+			t.Errorf("%v: PatientName %v", c.name, err)
+		}
+		warned := false
+		for _, w := range p.Warnings() {
+			warned = warned || (w.Tag == c.tag && strings.Contains(w.Message, "partial value"))
+		}
+		if !warned {
+			t.Errorf("%v: no warning for the truncated value in %v", c.name, p.Warnings())
+		}
+	}
+}
+
+// Lenient parses of a sequence cut off in its second item
+func TestParseTruncatedItem(t *testing.T) {
+	le := binary.LittleEndian
+	item := []byte{0xfe, 0xff, 0x00, 0xe0, 0xff, 0xff, 0xff, 0xff}
+	sq := []byte{0x08, 0x00, 0x40, 0x11, 'S', 'Q', 0, 0, 0xff, 0xff, 0xff, 0xff}
+	sq = append(sq, item...)
+	sq = append(sq, explicitElement(le, tag.ReferencedSOPInstanceUID, "UI", []byte("1.23"))...)
+	sq = append(sq, 0xfe, 0xff, 0x0d, 0xe0, 0, 0, 0, 0)
+	sq = append(sq, item...)
+	for _, c := range []struct {
+		name  string
+		data  []byte
+		items int
+	}{
+		// The empty partial item is dropped
+		{"empty", sq, 1},
+		{"empty header", append(sq, 0x08, 0x00), 1},
+		{"partial", append(sq, explicitElement(le, tag.ReferencedSOPInstanceUID, "UI", []byte("1.24"))...), 2},
+	} {
+		ds, err := NewParserWithOptions(ParseOptions{Lenient: true}).Parse(bytes.NewReader(c.data), true)
+		if err != nil {
+			t.Fatalf("%v: %v", c.name, err)
+		}
+		items, err := ds.GetSequence(tag.ReferencedImageSequence)
+		if err != nil || len(items) != c.items {
+			t.Errorf("%v: %v items, want %v, %v", c.name, len(items), c.items, err)
+			continue
+		}
+		for i, item := range items {
+			if item.Size() == 0 {
+				t.Errorf("%v: item %v empty", c.name, i)
+			}
+		}
+	}
+}
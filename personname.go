@@ -0,0 +1,165 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"strings"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+)
+
+// One component group of a PN value
+type PersonNameGroup struct {
+	FamilyName string
+	GivenName  string
+	MiddleName string
+	NamePrefix string
+	NameSuffix string
+}
+
+// A PN value with alphabetic, ideographic and phonetic component groups
+type PersonName struct {
+	Alphabetic  PersonNameGroup
+	Ideographic PersonNameGroup
+	Phonetic    PersonNameGroup
+}
+
+// Parse a single PN value, groups are separated by '=' and components by '^'
+func ParsePersonName(s string) (PersonName, error) {
+	var pn PersonName
+	groups := strings.Split(strings.TrimRight(s, " "), "=")
+	if len(groups) > 3 {
+		return pn, dcmerr.Errorf(dcmerr.ErrNotConvertible,
+			"invalid PN %q - %v component groups", s, len(groups))
+	}
+	for i, group := range groups {
+		g, ok := parsePersonNameGroup(group)
+		if !ok {
+			return pn, dcmerr.Errorf(dcmerr.ErrNotConvertible,
+				"invalid PN %q - too many components", s)
+		}
+		switch i {
+		case 0:
+			pn.Alphabetic = g
+		case 1:
+			pn.Ideographic = g
+		case 2:
+			pn.Phonetic = g
+		}
+	}
+	return pn, nil
+}
+
+func parsePersonNameGroup(s string) (PersonNameGroup, bool) {
+	var g PersonNameGroup
+	comps := strings.Split(s, "^")
+	if len(comps) > 5 {
+		return g, false
+	}
+	fields := g.fields()
+	for i, comp := range comps {
+		*fields[i] = strings.TrimSpace(comp)
+	}
+	return g, true
+}
+
+func (g *PersonNameGroup) fields() [5]*string {
+	return [5]*string{&g.FamilyName, &g.GivenName, &g.MiddleName,
+		&g.NamePrefix, &g.NameSuffix}
+}
+
+// The five components in order
+func (g PersonNameGroup) Components() []string {
+	return []string{g.FamilyName, g.GivenName, g.MiddleName, g.NamePrefix,
+		g.NameSuffix}
+}
+
+func (g PersonNameGroup) IsEmpty() bool {
+	return g == PersonNameGroup{}
+}
+
+// Format the group omitting trailing empty components
+func (g PersonNameGroup) String() string {
+	comps := g.Components()
+	n := len(comps)
+	for n > 0 && comps[n-1] == "" {
+		n--
+	}
+	return strings.Join(comps[:n], "^")
+}
+
+func (pn PersonName) IsEmpty() bool {
+	return pn == PersonName{}
+}
+
+// Format the name omitting trailing empty component groups
+func (pn PersonName) String() string {
+	groups := []string{pn.Alphabetic.String(), pn.Ideographic.String(),
+		pn.Phonetic.String()}
+	n := len(groups)
+	for n > 0 && groups[n-1] == "" {
+		n--
+	}
+	return strings.Join(groups[:n], "=")
+}
+
+// The first value of a PN element
+func (ds *Dataset) GetPersonName(tag uint32) (PersonName, error) {
+	str, err := ds.GetString(tag)
+	if err != nil {
+		return PersonName{}, err
+	}
+	return ParsePersonName(str)
+}
+
+// All values of a PN element
+func (ds *Dataset) GetPersonNames(tag uint32) ([]PersonName, error) {
+	strs, err := ds.GetStrings(tag)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]PersonName, len(strs))
+	for i, str := range strs {
+		if names[i], err = ParsePersonName(str); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+func (ds *Dataset) PutPersonName(tag uint32, names ...PersonName) error {
+	strs := make([]string, len(names))
+	for i, name := range names {
+		strs[i] = name.String()
+	}
+	return ds.PutString(tag, "PN", strings.Join(strs, "\\"))
+}
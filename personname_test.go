@@ -0,0 +1,138 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
+)
+
+func TestParsePersonName(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		want PersonName
+		str  string
+	}{
+		{"", PersonName{}, ""},
+		{"Doe", PersonName{Alphabetic: PersonNameGroup{FamilyName: "Doe"}}, "Doe"},
+		{"Doe^John^Q^Dr^Jr", PersonName{Alphabetic: PersonNameGroup{
+			FamilyName: "Doe", GivenName: "John", MiddleName: "Q", NamePrefix: "Dr", NameSuffix: "Jr"}},
+			"Doe^John^Q^Dr^Jr"},
+		// Trailing delimiters and padding are dropped
+		{"Doe^John^^^ ", PersonName{Alphabetic: PersonNameGroup{FamilyName: "Doe", GivenName: "John"}}, "Doe^John"},
+		{"Doe^John==", PersonName{Alphabetic: PersonNameGroup{FamilyName: "Doe", GivenName: "John"}}, "Doe^John"},
+		{"^John", PersonName{Alphabetic: PersonNameGroup{GivenName: "John"}}, "^John"},
+		{"=山田^太郎", PersonName{Ideographic: PersonNameGroup{FamilyName: "山田", GivenName: "太郎"}}, "=山田^太郎"},
+		{yamada, PersonName{
+			Alphabetic:  PersonNameGroup{FamilyName: "Yamada", GivenName: "Tarou"},
+			Ideographic: PersonNameGroup{FamilyName: "山田", GivenName: "太郎"},
+			Phonetic:    PersonNameGroup{FamilyName: "やまだ", GivenName: "たろう"}},
+			yamada},
+		{"Doe==ドウ", PersonName{
+			Alphabetic: PersonNameGroup{FamilyName: "Doe"},
+			Phonetic:   PersonNameGroup{FamilyName: "ドウ"}},
+			"Doe==ドウ"},
+	} {
+		pn, err := ParsePersonName(c.s)
+		if err != nil {
+			t.Errorf("%q: %v", c.s, err)
+			continue
+		}
+		if pn != c.want {
+			t.Errorf("%q: %+v, want %+v", c.s, pn, c.want)
+		}
+		if pn.String() != c.str {
+			t.Errorf("%q: String %q, want %q", c.s, pn.String(), c.str)
+		}
+		if pn.IsEmpty() != (c.str == "") {
+			t.Errorf("%q: IsEmpty %v", c.s, pn.IsEmpty())
+		}
+	}
+	for _, s := range []string{"a=b=c=d", "a^b^c^d^e^f", "=a^b^c^d^e^f"} {
+		if _, err := ParsePersonName(s); !dcmerr.IsErrNotConvertible(err) {
+			t.Errorf("%q: %v", s, err)
+		}
+	}
+}
+
+func TestPersonNameGroup(t *testing.T) {
+	g := PersonNameGroup{FamilyName: "Doe", MiddleName: "Q"}
+	if got := g.Components(); !reflect.DeepEqual(got, []string{"Doe", "", "Q", "", ""}) {
+		t.Errorf("Components %q", got)
+	}
+	if g.String() != "Doe^^Q" || g.IsEmpty() || !(PersonNameGroup{}).IsEmpty() {
+		t.Errorf("String %q", g.String())
+	}
+}
+
+func TestGetPersonNames(t *testing.T) {
+	ds := NewDataset()
+	ds.PutString(tag.OtherPatientNames, "PN", `Doe^John\Roe^Jane^^Ms\`)
+	names, err := ds.GetPersonNames(tag.OtherPatientNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PersonName{
+		{Alphabetic: PersonNameGroup{FamilyName: "Doe", GivenName: "John"}},
+		{Alphabetic: PersonNameGroup{FamilyName: "Roe", GivenName: "Jane", NamePrefix: "Ms"}},
+		{},
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("GetPersonNames %+v", names)
+	}
+	if pn, err := ds.GetPersonName(tag.OtherPatientNames); err != nil || pn != want[0] {
+		t.Errorf("GetPersonName %+v, %v", pn, err)
+	}
+
+	// Put joins the values
+	ds = NewDataset()
+	if err := ds.PutPersonName(tag.OtherPatientNames, want[:2]...); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := ds.GetStrings(tag.OtherPatientNames); !reflect.DeepEqual(s, []string{"Doe^John", "Roe^Jane^^Ms"}) {
+		t.Errorf("PutPersonName %q", s)
+	}
+	if names, err := ds.GetPersonNames(tag.OtherPatientNames); err != nil || !reflect.DeepEqual(names, want[:2]) {
+		t.Errorf("round trip %+v, %v", names, err)
+	}
+
+	ds.PutString(tag.PatientName, "PN", "a=b=c=d")
+	if _, err := ds.GetPersonNames(tag.PatientName); !dcmerr.IsErrNotConvertible(err) {
+		t.Errorf("invalid PN %v", err)
+	}
+	if _, err := ds.GetPersonName(tag.ReferringPhysicianName); !dcmerr.IsErrNotFound(err) {
+		t.Errorf("missing PN %v", err)
+	}
+}
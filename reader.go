@@ -36,6 +36,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
+	"math"
 
 	"github.com/JamesDarcy616/dicom/dcmerr"
 )
@@ -46,15 +47,19 @@ type Reader interface {
 	BytesRead() uint64
 	IsExplicit() bool
 	Peek(n int) ([]byte, error)
+	ReadBytes(buf []byte) error
 	ReadFloat32() (float32, error)
 	ReadFloat64() (float64, error)
 	ReadInt16() (int16, error)
 	ReadInt32() (int32, error)
+	ReadInt64() (int64, error)
 	ReadString(n uint32) (string, error)
 	ReadUint16() (uint16, error)
 	ReadUint16LE() (uint16, error)
 	ReadUint32() (uint32, error)
 	ReadUint32LE() (uint32, error)
+	ReadUint64() (uint64, error)
+	SetByteOrder(binary.ByteOrder)
 	SetExplicit(bool)
 	Skip(n int64) error
 }
@@ -64,6 +69,11 @@ type reader struct {
 	in       bufio.Reader
 	nRead    uint64
 	order    binary.ByteOrder
+	// Set when Skip can seek rather than read
+	seeker io.ReadSeeker
+	size   int64
+	// Avoids allocating for each number read
+	scratch [8]byte
 }
 
 func NewReader(r io.Reader, order binary.ByteOrder, explicit bool) Reader {
@@ -75,6 +85,18 @@ func NewReader(r io.Reader, order binary.ByteOrder, explicit bool) Reader {
 	}
 }
 
+// A Reader that seeks over skipped values rather than reading them
+func NewReadSeeker(rs io.ReadSeeker, order binary.ByteOrder, explicit bool) Reader {
+	r := NewReader(rs, order, explicit).(*reader)
+	r.setSeeker(rs)
+	return r
+}
+
+// A Reader over the first size bytes of ra that seeks over skipped values
+func NewReaderAt(ra io.ReaderAt, size int64, order binary.ByteOrder, explicit bool) Reader {
+	return NewReadSeeker(io.NewSectionReader(ra, 0, size), order, explicit)
+}
+
 func (r *reader) ByteOrder() binary.ByteOrder {
 	return r.order
 }
@@ -101,68 +123,60 @@ func (r *reader) Read(buf []byte) (int, error) {
 	return n, err
 }
 
-func (r *reader) ReadFloat32() (float32, error) {
-	var v float32
-	if err := binary.Read(r, r.order, &v); err != nil {
+// Fill buf, failing with ErrEOF if nothing could be read
+func (r *reader) ReadBytes(buf []byte) error {
+	if _, err := io.ReadFull(r, buf); err != nil {
 		if err == io.EOF {
-			return v, dcmerr.NewErrEOF()
+			return dcmerr.NewErrEOF()
 		}
 		if err == io.ErrUnexpectedEOF {
-			return v, dcmerr.Errorf(dcmerr.ErrUnexpectedEOF,
+			return dcmerr.Errorf(dcmerr.ErrUnexpectedEOF,
 				"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
 		}
-		return 0, dcmerr.Errorf(dcmerr.ErrIO,
+		return dcmerr.Errorf(dcmerr.ErrIO,
 			"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
 	}
-	return v, nil
+	return nil
+}
+
+func (r *reader) ReadFloat32() (float32, error) {
+	b := r.scratch[:4]
+	if err := r.ReadBytes(b); err != nil {
+		return 0, err
+	}
+	return math.Float32frombits(r.order.Uint32(b)), nil
 }
 
 func (r *reader) ReadFloat64() (float64, error) {
-	var v float64
-	if err := binary.Read(r, r.order, &v); err != nil {
-		if err == io.EOF {
-			return v, dcmerr.NewErrEOF()
-		}
-		if err == io.ErrUnexpectedEOF {
-			return v, dcmerr.Errorf(dcmerr.ErrUnexpectedEOF,
-				"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
-		}
-		return 0, dcmerr.Errorf(dcmerr.ErrIO,
-			"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
+	b := r.scratch[:8]
+	if err := r.ReadBytes(b); err != nil {
+		return 0, err
 	}
-	return v, nil
+	return math.Float64frombits(r.order.Uint64(b)), nil
 }
 
 func (r *reader) ReadInt16() (int16, error) {
-	var v int16
-	if err := binary.Read(r, r.order, &v); err != nil {
-		if err == io.EOF {
-			return v, dcmerr.NewErrEOF()
-		}
-		if err == io.ErrUnexpectedEOF {
-			return v, dcmerr.Errorf(dcmerr.ErrUnexpectedEOF,
-				"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
-		}
-		return 0, dcmerr.Errorf(dcmerr.ErrIO,
-			"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
+	b := r.scratch[:2]
+	if err := r.ReadBytes(b); err != nil {
+		return 0, err
 	}
-	return v, nil
+	return int16(r.order.Uint16(b)), nil
 }
 
 func (r *reader) ReadInt32() (int32, error) {
-	var v int32
-	if err := binary.Read(r, r.order, &v); err != nil {
-		if err == io.EOF {
-			return v, dcmerr.NewErrEOF()
-		}
-		if err == io.ErrUnexpectedEOF {
-			return v, dcmerr.Errorf(dcmerr.ErrUnexpectedEOF,
-				"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
-		}
-		return 0, dcmerr.Errorf(dcmerr.ErrIO,
-			"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
+	b := r.scratch[:4]
+	if err := r.ReadBytes(b); err != nil {
+		return 0, err
 	}
-	return v, nil
+	return int32(r.order.Uint32(b)), nil
+}
+
+func (r *reader) ReadInt64() (int64, error) {
+	b := r.scratch[:8]
+	if err := r.ReadBytes(b); err != nil {
+		return 0, err
+	}
+	return int64(r.order.Uint64(b)), nil
 }
 
 func (r *reader) ReadString(len uint32) (string, error) {
@@ -181,67 +195,47 @@ func (r *reader) ReadString(len uint32) (string, error) {
 }
 
 func (r *reader) ReadUint16() (uint16, error) {
-	var v uint16
-	if err := binary.Read(r, r.order, &v); err != nil {
-		if err == io.EOF {
-			return v, dcmerr.NewErrEOF()
-		}
-		if err == io.ErrUnexpectedEOF {
-			return v, dcmerr.Errorf(dcmerr.ErrUnexpectedEOF,
-				"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
-		}
-		return 0, dcmerr.Errorf(dcmerr.ErrIO,
-			"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
+	b := r.scratch[:2]
+	if err := r.ReadBytes(b); err != nil {
+		return 0, err
 	}
-	return v, nil
+	return r.order.Uint16(b), nil
 }
 
 func (r *reader) ReadUint16LE() (uint16, error) {
-	var v uint16
-	if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
-		if err == io.EOF {
-			return v, dcmerr.NewErrEOF()
-		}
-		if err == io.ErrUnexpectedEOF {
-			return v, dcmerr.Errorf(dcmerr.ErrUnexpectedEOF,
-				"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
-		}
-		return 0, dcmerr.Errorf(dcmerr.ErrIO,
-			"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
+	b := r.scratch[:2]
+	if err := r.ReadBytes(b); err != nil {
+		return 0, err
 	}
-	return v, nil
+	return binary.LittleEndian.Uint16(b), nil
 }
 
 func (r *reader) ReadUint32() (uint32, error) {
-	var v uint32
-	if err := binary.Read(r, r.order, &v); err != nil {
-		if err == io.EOF {
-			return v, dcmerr.NewErrEOF()
-		}
-		if err == io.ErrUnexpectedEOF {
-			return v, dcmerr.Errorf(dcmerr.ErrUnexpectedEOF,
-				"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
-		}
-		return 0, dcmerr.Errorf(dcmerr.ErrIO,
-			"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
+	b := r.scratch[:4]
+	if err := r.ReadBytes(b); err != nil {
+		return 0, err
 	}
-	return v, nil
+	return r.order.Uint32(b), nil
 }
 
 func (r *reader) ReadUint32LE() (uint32, error) {
-	var v uint32
-	if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
-		if err == io.EOF {
-			return v, dcmerr.NewErrEOF()
-		}
-		if err == io.ErrUnexpectedEOF {
-			return v, dcmerr.Errorf(dcmerr.ErrUnexpectedEOF,
-				"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
-		}
-		return 0, dcmerr.Errorf(dcmerr.ErrIO,
-			"error near byte %v (%08x) - %v", r.nRead, r.nRead, err.Error())
+	b := r.scratch[:4]
+	if err := r.ReadBytes(b); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (r *reader) ReadUint64() (uint64, error) {
+	b := r.scratch[:8]
+	if err := r.ReadBytes(b); err != nil {
+		return 0, err
 	}
-	return v, nil
+	return r.order.Uint64(b), nil
+}
+
+func (r *reader) SetByteOrder(order binary.ByteOrder) {
+	r.order = order
 }
 
 func (r *reader) SetExplicit(explicit bool) {
@@ -249,10 +243,50 @@ func (r *reader) SetExplicit(explicit bool) {
 }
 
 func (r *reader) Skip(n int64) error {
+	if r.seeker != nil && n > int64(r.in.Buffered()) {
+		return r.seek(n)
+	}
 	_, err := io.CopyN(io.Discard, r, n)
 	if err != nil {
-		dcmerr.Errorf(dcmerr.ErrIO,
+		return dcmerr.Errorf(dcmerr.ErrIO,
 			"error skipping ahead at byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
 	}
 	return nil
 }
+
+// Reuse the buffer of r to read from rs
+func (r *reader) reset(rs io.ReadSeeker, order binary.ByteOrder, explicit bool) {
+	r.explicit = explicit
+	r.in.Reset(rs)
+	r.nRead = 0
+	r.order = order
+	r.setSeeker(rs)
+}
+
+func (r *reader) setSeeker(rs io.ReadSeeker) {
+	r.seeker = rs
+	r.size = -1
+	if pos, err := rs.Seek(0, io.SeekCurrent); err == nil {
+		if end, err := rs.Seek(0, io.SeekEnd); err == nil {
+			r.size = end
+		}
+		rs.Seek(pos, io.SeekStart)
+	}
+}
+
+// Skip n bytes, some of which may be buffered, by seeking the source
+func (r *reader) seek(n int64) error {
+	pos, err := r.seeker.Seek(n-int64(r.in.Buffered()), io.SeekCurrent)
+	if err != nil {
+		return dcmerr.Errorf(dcmerr.ErrIO,
+			"error skipping ahead at byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), err.Error())
+	}
+	r.in.Reset(r.seeker)
+	if r.size >= 0 && pos > r.size {
+		r.nRead += uint64(n) - uint64(pos-r.size)
+		return dcmerr.Errorf(dcmerr.ErrIO,
+			"error skipping ahead at byte %v (%08x) - %v", r.BytesRead(), r.BytesRead(), io.EOF.Error())
+	}
+	r.nRead += uint64(n)
+	return nil
+}
@@ -0,0 +1,187 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/tag"
+	"github.com/JamesDarcy616/dicom/uid"
+)
+
+// Counts the bytes read rather than seeked over
+type countingReader struct {
+	*bytes.Reader
+	n int
+}
+
+func (r *countingReader) Read(buf []byte) (int, error) {
+	n, err := r.Reader.Read(buf)
+	r.n += n
+	return n, err
+}
+
+func TestReaderSkip(t *testing.T) {
+	data := make([]byte, 100000)
+	binary.LittleEndian.PutUint32(data[90000:], 0x12345678)
+	src := &countingReader{Reader: bytes.NewReader(data)}
+	r := NewReadSeeker(src, binary.LittleEndian, true)
+	if _, err := r.ReadUint32(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Skip(89996); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := r.ReadUint32(); err != nil || v != 0x12345678 {
+		t.Errorf("ReadUint32 after Skip %08x, %v", v, err)
+	}
+	if r.BytesRead() != 90004 {
+		t.Errorf("BytesRead %v", r.BytesRead())
+	}
+	// Only the buffered reads were read, the rest was seeked over
+	if src.n >= 20000 {
+		t.Errorf("%v bytes read", src.n)
+	}
+}
+
+func TestReaderSkipEOF(t *testing.T) {
+	data := make([]byte, 10000)
+	for _, c := range []struct {
+		name string
+		r    Reader
+	}{
+		{"seeker", NewReadSeeker(bytes.NewReader(data), binary.LittleEndian, true)},
+		{"reader", NewReader(bytes.NewReader(data), binary.LittleEndian, true)},
+		{"reader at", NewReaderAt(bytes.NewReader(data), 5000, binary.LittleEndian, true)},
+	} {
+		size := uint64(len(data))
+		if c.name == "reader at" {
+			size = 5000
+		}
+		if err := c.r.Skip(100); err != nil {
+			t.Fatal(err)
+		}
+		// Short skips count only the bytes available
+		if err := c.r.Skip(20000); err == nil {
+			t.Errorf("%v: Skip past EOF", c.name)
+		}
+		if c.r.BytesRead() != size {
+			t.Errorf("%v: BytesRead %v, want %v", c.name, c.r.BytesRead(), size)
+		}
+		if _, err := c.r.ReadUint16(); err == nil {
+			t.Errorf("%v: read past EOF", c.name)
+		}
+	}
+}
+
+// A file with PixelData large enough to be seeked over when excluded
+func readerAtFile(t *testing.T) string {
+	t.Helper()
+	ds := NewDataset()
+	ds.Put(testElement(t, tag.PatientID, "LO", "123"))
+	ds.Put(testElement(t, tag.PixelData, "OB", bytes.Repeat([]byte{5}, 65536)))
+	ds.Put(testElement(t, tag.DataSetTrailingPadding, "OB", []byte{1, 2}))
+	return testFile(t, ds, uid.ExplicitVRLittleEndian)
+}
+
+func TestParseReaderAt(t *testing.T) {
+	filename := readerAtFile(t)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err := NewParserWithOptions(ParseOptions{ExcludeTags: []uint32{tag.PixelData}}).
+		ParseReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.Get(tag.PixelData); err == nil {
+		t.Error("excluded PixelData read")
+	}
+	if v, err := ds.GetBytes(tag.DataSetTrailingPadding); err != nil || !bytes.Equal(v, []byte{1, 2}) {
+		t.Errorf("element after PixelData %v, %v", v, err)
+	}
+
+	// Values are loaded from the ReaderAt
+	ds, err = NewParserWithOptions(ParseOptions{LazyLoadSize: 1024}).
+		ParseReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := ds.GetBytes(tag.PixelData); err != nil || len(v) != 65536 {
+		t.Errorf("lazy PixelData %v bytes, %v", len(v), err)
+	}
+
+	// Truncated by size
+	if _, err := NewParser().ParseReaderAt(bytes.NewReader(data), int64(len(data))-1000); err == nil {
+		t.Error("parse truncated file")
+	}
+}
+
+func TestOpenMapped(t *testing.T) {
+	m, err := OpenMapped(readerAtFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := NewParserWithOptions(ParseOptions{LazyLoadSize: 1024}).ParseReaderAt(m, m.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := ds.GetString(tag.PatientID); err != nil || id != "123" {
+		t.Errorf("PatientID %v, %v", id, err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Lazy values can't be loaded once closed
+	if _, err := ds.GetBytes(tag.PixelData); err == nil {
+		t.Error("PixelData loaded after Close")
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.dcm")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err = OpenMapped(empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if _, err := NewParser().ParseReaderAt(m, m.Size()); err == nil {
+		t.Error("parse empty file")
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/tag"
+	"github.com/JamesDarcy616/dicom/uid"
+)
+
+func sourceDataset(t *testing.T) *Dataset {
+	item := NewDataset()
+	item.Put(testElement(t, tag.ReferencedSOPInstanceUID, "UI", "1.2.3.4.6"))
+	item.Put(testElement(t, tag.SimpleFrameList, "UL", []uint32{1, 2}))
+	ds := NewDataset()
+	ds.Put(testElement(t, tag.PatientName, "PN", "Doe^John"))
+	ds.Put(NewElement(tag.ReferencedImageSequence, "SQ", UndefinedLength, testValue(t, []*Dataset{item, item})))
+	ds.Put(NewElement(tag.PurposeOfReferenceCodeSequence, "SQ", 0, testValue(t, []*Dataset{item})))
+	ds.Put(testElement(t, tag.EncapsulatedDocument, "OB", []byte{1, 2, 3, 4}))
+	return ds
+}
+
+// Check the recorded source of every element and item of ds against the
+// encoded data it was parsed from
+func checkSource(t *testing.T, data []byte, order binary.ByteOrder, explicit bool, ds *Dataset) {
+	t.Helper()
+	iter := ds.Iterator()
+	for iter.Next() {
+		elem := iter.Value()
+		src := elem.Source
+		if src == nil {
+			t.Errorf("%08x: no source", elem.Tag)
+			continue
+		}
+		b := data[src.Offset:]
+		if tag32 := uint32(order.Uint16(b))<<16 | uint32(order.Uint16(b[2:])); tag32 != elem.Tag {
+			t.Errorf("%08x: tag %08x at offset %v", elem.Tag, tag32, src.Offset)
+			continue
+		}
+		wantHeader, wantVR, vl := uint32(8), "", uint32(0)
+		switch {
+		case !explicit:
+			vl = order.Uint32(b[4:])
+		case useShortVL(string(b[4:6])):
+			wantVR, vl = string(b[4:6]), uint32(order.Uint16(b[6:]))
+		default:
+			wantHeader, wantVR, vl = 12, string(b[4:6]), order.Uint32(b[8:])
+		}
+		if src.HeaderLength != wantHeader || src.VR != wantVR || src.UndefinedLength != (vl == UndefinedLength) {
+			t.Errorf("%08x: source %+v, want header %v, VR %q, VL %08x", elem.Tag, *src, wantHeader, wantVR, vl)
+		}
+		sq, ok := elem.Value.(*sqValue)
+		if !ok {
+			continue
+		}
+		for _, item := range sq.value {
+			isrc := item.Source()
+			if isrc == nil {
+				t.Errorf("%08x: item has no source", elem.Tag)
+				continue
+			}
+			// Item headers are always little endian
+			b := data[isrc.Offset:]
+			itemVL := binary.LittleEndian.Uint32(b[4:])
+			if binary.LittleEndian.Uint32(b) != 0xe000fffe || isrc.HeaderLength != 8 ||
+				isrc.UndefinedLength != (itemVL == UndefinedLength) {
+				t.Errorf("%08x: item source %+v at % x", elem.Tag, *isrc, b[:8])
+			}
+			checkSource(t, data, order, explicit, item)
+		}
+	}
+}
+
+func TestKeepSource(t *testing.T) {
+	for _, explicit := range []bool{true, false} {
+		var buf bytes.Buffer
+		if err := Write(&buf, sourceDataset(t), explicit, WithUndefinedLengthSequences()); err != nil {
+			t.Fatal(err)
+		}
+		ds, err := NewParserWithOptions(ParseOptions{KeepSource: true}).Parse(bytes.NewReader(buf.Bytes()), explicit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSource(t, buf.Bytes(), binary.LittleEndian, explicit, ds)
+	}
+}
+
+func TestKeepSourceDeflated(t *testing.T) {
+	filename := testFile(t, sourceDataset(t), uid.DeflatedExplicitVRLittleEndian)
+	ds, err := NewParserWithOptions(ParseOptions{KeepSource: true}).ParseFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// File meta offsets are from the start of the file
+	groupLen, err := ds.Get(tag.FileMetaInformationGroupLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groupLen.Source.Offset != preambleLength+uint64(len(magic)) {
+		t.Errorf("group length offset %v", groupLen.Source.Offset)
+	}
+	// Body offsets are from the start of the inflated body
+	bodyStart := groupLen.Source.Offset + 12 + uint64(groupLen.Value.Get().(uint32))
+	body, err := io.ReadAll(flate.NewReader(bytes.NewReader(data[bodyStart:])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bodyDS := NewDataset()
+	iter := ds.Iterator()
+	for iter.Next() {
+		if elem := iter.Value(); elem.Tag>>16 != 0x0002 {
+			bodyDS.Put(elem)
+		}
+	}
+	checkSource(t, body, binary.LittleEndian, true, bodyDS)
+
+	// The file meta is iterated first, then the body in the order read
+	var order []uint32
+	for iter := ds.SourceIterator(); iter.Next(); {
+		order = append(order, iter.Value().Tag)
+	}
+	want := []uint32{tag.FileMetaInformationGroupLength, tag.MediaStorageSOPClassUID,
+		tag.MediaStorageSOPInstanceUID, tag.TransferSyntaxUID, tag.ReferencedImageSequence,
+		tag.PatientName, tag.PurposeOfReferenceCodeSequence, tag.EncapsulatedDocument}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("SourceIterator order %08x, want %08x", order, want)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/tag"
+)
+
+const privateSequence uint32 = 0x00091010
+
+// An ImpLE element with a 32 bit length
+func implicitElement(tag32 uint32, value []byte) []byte {
+	b := make([]byte, 8, 8+len(value))
+	binary.LittleEndian.PutUint16(b, uint16(tag32>>16))
+	binary.LittleEndian.PutUint16(b[2:], uint16(tag32))
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(value)))
+	return append(b, value...)
+}
+
+// An ExpLE stream with ReferencedImageSequence as undefined length UN, its
+// item holds an unknown private tag with an undefined length sequence value.
+// Both are encoded in ImpLE.
+func unSequenceStream() []byte {
+	le := binary.LittleEndian
+	undefined := []byte{0xff, 0xff, 0xff, 0xff}
+	item := []byte{0xfe, 0xff, 0x00, 0xe0, 0xff, 0xff, 0xff, 0xff}
+	itemDelim := []byte{0xfe, 0xff, 0x0d, 0xe0, 0, 0, 0, 0}
+	sqDelim := []byte{0xfe, 0xff, 0xdd, 0xe0, 0, 0, 0, 0}
+
+	var data []byte
+	data = append(data, explicitElement(le, tag.SOPInstanceUID, "UI", []byte("1.2.34"))...)
+	data = append(data, 0x08, 0x00, 0x40, 0x11, 'U', 'N', 0, 0)
+	data = append(data, undefined...)
+	data = append(data, item...)
+	data = append(data, implicitElement(tag.ReferencedSOPInstanceUID, []byte("1.23"))...)
+	data = append(data, 0x09, 0x00, 0x10, 0x10)
+	data = append(data, undefined...)
+	data = append(data, item...)
+	data = append(data, implicitElement(tag.PatientID, []byte("ID01"))...)
+	data = append(data, itemDelim...)
+	data = append(data, sqDelim...)
+	data = append(data, itemDelim...)
+	data = append(data, sqDelim...)
+	return append(data, explicitElement(le, tag.PatientName, "PN", []byte("Doe^John"))...)
+}
+
+// Check the nested sequences of unSequenceStream have VR vr
+func checkUNSequence(t *testing.T, ds *Dataset, vr string) {
+	t.Helper()
+	elem, err := ds.Get(tag.ReferencedImageSequence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elem.VR != vr {
+		t.Errorf("ReferencedImageSequence VR %v, want %v", elem.VR, vr)
+	}
+	item, err := ds.GetSequenceItem(tag.ReferencedImageSequence, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid, _ := item.GetString(tag.ReferencedSOPInstanceUID); uid != "1.23" {
+		t.Errorf("ReferencedSOPInstanceUID %q", uid)
+	}
+	elem, err = item.Get(privateSequence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elem.VR != vr {
+		t.Errorf("private sequence VR %v, want %v", elem.VR, vr)
+	}
+	nested, err := item.GetSequenceItem(privateSequence, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := nested.GetString(tag.PatientID); id != "ID01" {
+		t.Errorf("PatientID %q", id)
+	}
+	// The body continues in ExpLE after the sequence
+	if name, _ := ds.GetString(tag.PatientName); name != "Doe^John" {
+		t.Errorf("PatientName %q", name)
+	}
+}
+
+func TestUNSequence(t *testing.T) {
+	data := unSequenceStream()
+	ds, err := NewParser().Parse(bytes.NewReader(data), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUNSequence(t, ds, "UN")
+
+	// Kept as UN the sequences are written as read
+	var buf bytes.Buffer
+	if err := Write(&buf, ds, true); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("written\n% x\nwant\n% x", buf.Bytes(), data)
+	}
+}
+
+func TestRetypeUNSequences(t *testing.T) {
+	ds, err := NewParserWithOptions(ParseOptions{RetypeUNSequences: true}).
+		Parse(bytes.NewReader(unSequenceStream()), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUNSequence(t, ds, "SQ")
+
+	// Written as SQ in the TransferSyntax, undefined length so the private
+	// sequence is still recognised in ImpLE
+	for _, explicit := range []bool{true, false} {
+		var buf bytes.Buffer
+		if err := Write(&buf, ds, explicit, WithUndefinedLengthSequences()); err != nil {
+			t.Fatal(err)
+		}
+		out, err := NewParserWithOptions(ParseOptions{RetypeUNSequences: true}).Parse(&buf, explicit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkUNSequence(t, out, "SQ")
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// Called with the header of each element in the body before its value is
+// read, path holds the tags of the enclosing sequences. Returning true ends
+// the parse without reading elem and the elements read so far, including
+// partly read sequences, are returned.
+type StopFunc func(path []uint32, elem *Element) bool
+
+func (p *Parser) ParseUntilFunc(r io.Reader, explicit bool, stop StopFunc) (*Dataset, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.reset(context.Background())
+	ds := NewDataset()
+	reader := NewReader(r, binary.LittleEndian, explicit)
+	p.stop = stop
+	err := p.parseAll(ds, reader)
+	if err != nil {
+		return p.partialDataset(ds, reader, err)
+	}
+
+	return ds, nil
+}
+
+func (p *Parser) ParseFileUntilFunc(filename string, stop StopFunc) (*Dataset, error) {
+	return p.ParseFileUntilFuncContext(context.Background(), filename, stop)
+}
+
+// ParseFileUntilFunc checking ctx for cancellation between elements
+func (p *Parser) ParseFileUntilFuncContext(ctx context.Context, filename string, stop StopFunc) (*Dataset, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.reset(ctx)
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	// Source of values loaded on first access
+	p.source = fileSource(filename)
+	defer func() { p.source = nil }()
+
+	// Start in ExpLE mode for file metadata, changed if there is none
+	reader := p.fileReader(file)
+	return p.parsePart10(reader, func(ds *Dataset, r Reader) error {
+		// File meta is always read in full
+		p.stop = stop
+		return p.parseAll(ds, r)
+	})
+}
+
+// A StopFunc for a single parse that stops once the first element at each
+// path has been read, or can no longer be found. Each path is the tags of the
+// enclosing sequences followed by the element tag.
+func UntilTags(paths ...[]uint32) StopFunc {
+	found := make([]bool, len(paths))
+	return func(path []uint32, elem *Element) bool {
+		for i, want := range paths {
+			if !found[i] && matchPath(want, path, elem.Tag) {
+				found[i] = true
+				return false
+			}
+		}
+		// Top level tags are in ascending order
+		top := elem.Tag
+		if len(path) > 0 {
+			top = path[0]
+		}
+		for i, want := range paths {
+			if len(want) == 0 {
+				continue
+			}
+			if found[i] {
+				// Still reading the items of a wanted sequence
+				if len(path) >= len(want) && matchPath(want, path[:len(want)-1], path[len(want)-1]) {
+					return false
+				}
+				continue
+			}
+			if want[0] >= top {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func matchPath(want, path []uint32, tag32 uint32) bool {
+	if len(want) != len(path)+1 || want[len(path)] != tag32 {
+		return false
+	}
+	for i, t := range path {
+		if want[i] != t {
+			return false
+		}
+	}
+	return true
+}
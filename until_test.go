@@ -0,0 +1,142 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/tag"
+	"github.com/JamesDarcy616/dicom/uid"
+)
+
+// A file with a ReferencedImageSequence of two items, only the second has a
+// ReferencedSOPInstanceUID
+func untilFile(t *testing.T) string {
+	t.Helper()
+	item1 := NewDataset()
+	item1.Put(testElement(t, tag.ReferencedSOPClassUID, "UI", "1.2.1"))
+	item2 := NewDataset()
+	item2.Put(testElement(t, tag.ReferencedSOPClassUID, "UI", "1.2.2"))
+	item2.Put(testElement(t, tag.ReferencedSOPInstanceUID, "UI", "1.2.3"))
+	ds := NewDataset()
+	ds.Put(testElement(t, tag.SOPInstanceUID, "UI", "1.2.4"))
+	if err := ds.PutSequence(tag.ReferencedImageSequence, item1, item2); err != nil {
+		t.Fatal(err)
+	}
+	ds.Put(testElement(t, tag.PatientName, "PN", "Doe^John"))
+	ds.Put(testElement(t, tag.PatientID, "LO", "123"))
+	ds.Put(testElement(t, tag.StudyInstanceUID, "UI", "1.2.5"))
+	return testFile(t, ds, uid.ExplicitVRLittleEndian)
+}
+
+// Tags of the elements in ds outside group 0002
+func bodyTags(ds *Dataset) []uint32 {
+	tags := []uint32{}
+	for iter := ds.Iterator(); iter.Next(); {
+		if tag32 := iter.Value().Tag; tag32>>16 != 0x0002 {
+			tags = append(tags, tag32)
+		}
+	}
+	return tags
+}
+
+func TestParseFileUntilFunc(t *testing.T) {
+	filename := untilFile(t)
+	refs := tag.ReferencedImageSequence
+	for _, c := range []struct {
+		name string
+		stop StopFunc
+		// Top level tags and the tags of each ReferencedImageSequence item
+		want  []uint32
+		items [][]uint32
+	}{
+		{
+			name:  "top level",
+			stop:  UntilTags([]uint32{tag.PatientName}),
+			want:  []uint32{tag.SOPInstanceUID, refs, tag.PatientName},
+			items: [][]uint32{{tag.ReferencedSOPClassUID}, {tag.ReferencedSOPClassUID, tag.ReferencedSOPInstanceUID}},
+		},
+		{
+			name:  "top level unordered paths",
+			stop:  UntilTags([]uint32{tag.PatientID}, []uint32{tag.SOPInstanceUID}),
+			want:  []uint32{tag.SOPInstanceUID, refs, tag.PatientName, tag.PatientID},
+			items: [][]uint32{{tag.ReferencedSOPClassUID}, {tag.ReferencedSOPClassUID, tag.ReferencedSOPInstanceUID}},
+		},
+		{
+			name:  "nested in a later item",
+			stop:  UntilTags([]uint32{refs, tag.ReferencedSOPInstanceUID}),
+			want:  []uint32{tag.SOPInstanceUID, refs},
+			items: [][]uint32{{tag.ReferencedSOPClassUID}, {tag.ReferencedSOPClassUID, tag.ReferencedSOPInstanceUID}},
+		},
+		{
+			name: "missing sequence",
+			stop: UntilTags([]uint32{tag.ReferencedStudySequence, tag.ReferencedSOPInstanceUID}),
+			want: []uint32{tag.SOPInstanceUID},
+		},
+		{
+			name:  "missing top level tag",
+			stop:  UntilTags([]uint32{tag.PatientBirthDate}),
+			want:  []uint32{tag.SOPInstanceUID, refs, tag.PatientName, tag.PatientID},
+			items: [][]uint32{{tag.ReferencedSOPClassUID}, {tag.ReferencedSOPClassUID, tag.ReferencedSOPInstanceUID}},
+		},
+		{
+			name: "stop mid sequence",
+			stop: func(path []uint32, elem *Element) bool {
+				return elem.Tag == tag.ReferencedSOPInstanceUID
+			},
+			want:  []uint32{tag.SOPInstanceUID, refs},
+			items: [][]uint32{{tag.ReferencedSOPClassUID}, {tag.ReferencedSOPClassUID}},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ds, err := NewParser().ParseFileUntilFunc(filename, c.stop)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := bodyTags(ds); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("tags %08x, want %08x", got, c.want)
+			}
+			items, _ := ds.GetSequence(refs)
+			got := [][]uint32{}
+			for _, item := range items {
+				got = append(got, bodyTags(item))
+			}
+			if c.items == nil {
+				c.items = [][]uint32{}
+			}
+			if !reflect.DeepEqual(got, c.items) {
+				t.Errorf("items %08x, want %08x", got, c.items)
+			}
+		})
+	}
+}
@@ -39,8 +39,13 @@ import (
 )
 
 type Value interface {
+	// The first value, nil if the value is empty
 	Get() interface{}
 	GetAll() interface{}
+	// True for a zero length value, GetAll returns an empty slice or nil
+	IsEmpty() bool
+	// Number of values returned by GetAll, the VM for most VRs
+	Len() int
 	String() string
 }
 
@@ -50,7 +55,7 @@ func NewValue(raw interface{}) (Value, error) {
 	}
 	switch raw := raw.(type) {
 	case string:
-		return &stringValue{value: nullStrip(raw)}, nil
+		return newStringValue("", raw), nil
 	case []uint32:
 		return &uint32Value{value: raw}, nil
 	case []uint16:
@@ -59,14 +64,22 @@ func NewValue(raw interface{}) (Value, error) {
 		return &int32Value{value: raw}, nil
 	case []int16:
 		return &int16Value{value: raw}, nil
+	case []int64:
+		return &int64Value{value: raw}, nil
 	case []byte:
 		return &bytesValue{value: raw}, nil
 	case []float32:
 		return &float32Value{value: raw}, nil
 	case []float64:
 		return &float64Value{value: raw}, nil
+	case []uint64:
+		return &uint64Value{value: raw}, nil
 	case []*Dataset:
 		return &sqValue{value: raw}, nil
+	case *EncapsulatedPixelData:
+		return &encapsulatedValue{value: raw}, nil
+	case []AttributeTag:
+		return &tagValue{value: raw}, nil
 	default:
 		return nil, dcmerr.Errorf(dcmerr.ErrUnsupported, "unknown or unsupported type: %T", raw)
 	}
@@ -76,80 +89,249 @@ type bytesValue struct {
 	value []byte
 }
 
-func (v *bytesValue) Get() interface{}    { return v.value }
+func (v *bytesValue) Get() interface{} {
+	if len(v.value) == 0 {
+		return nil
+	}
+	return v.value
+}
 func (v *bytesValue) GetAll() interface{} { return v.value }
+func (v *bytesValue) IsEmpty() bool       { return len(v.value) == 0 }
+func (v *bytesValue) Len() int            { return len(v.value) }
 func (v *bytesValue) String() string      { return fmt.Sprintf("%v", v.value) }
 
 type emptyValue struct{}
 
 func (v *emptyValue) Get() interface{}    { return nil }
 func (v *emptyValue) GetAll() interface{} { return nil }
-func (v *emptyValue) String() string      { return fmt.Sprintf("%v", nil) }
+func (v *emptyValue) IsEmpty() bool       { return true }
+func (v *emptyValue) Len() int            { return 0 }
+func (v *emptyValue) String() string      { return "" }
+
+type encapsulatedValue struct {
+	value *EncapsulatedPixelData
+}
+
+func (v *encapsulatedValue) Get() interface{}    { return v.value }
+func (v *encapsulatedValue) GetAll() interface{} { return v.value }
+func (v *encapsulatedValue) IsEmpty() bool       { return v.value == nil }
+
+// Number of fragments, excluding the Basic Offset Table
+func (v *encapsulatedValue) Len() int {
+	if v.value == nil {
+		return 0
+	}
+	return len(v.value.Fragments)
+}
+
+func (v *encapsulatedValue) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v offsets, %v fragments", len(v.value.BasicOffsetTable), len(v.value.Fragments))
+}
 
 type float32Value struct {
 	value []float32
 }
 
-func (v *float32Value) Get() interface{}    { return v.value[0] }
+func (v *float32Value) Get() interface{} {
+	if len(v.value) == 0 {
+		return nil
+	}
+	return v.value[0]
+}
 func (v *float32Value) GetAll() interface{} { return v.value }
+func (v *float32Value) IsEmpty() bool       { return len(v.value) == 0 }
+func (v *float32Value) Len() int            { return len(v.value) }
 func (v *float32Value) String() string      { return fmt.Sprintf("%v", v.value) }
 
 type float64Value struct {
 	value []float64
 }
 
-func (v *float64Value) Get() interface{}    { return v.value[0] }
+func (v *float64Value) Get() interface{} {
+	if len(v.value) == 0 {
+		return nil
+	}
+	return v.value[0]
+}
 func (v *float64Value) GetAll() interface{} { return v.value }
+func (v *float64Value) IsEmpty() bool       { return len(v.value) == 0 }
+func (v *float64Value) Len() int            { return len(v.value) }
 func (v *float64Value) String() string      { return fmt.Sprintf("%v", v.value) }
 
 type int16Value struct {
 	value []int16
 }
 
-func (v *int16Value) Get() interface{}    { return v.value[0] }
+func (v *int16Value) Get() interface{} {
+	if len(v.value) == 0 {
+		return nil
+	}
+	return v.value[0]
+}
 func (v *int16Value) GetAll() interface{} { return v.value }
+func (v *int16Value) IsEmpty() bool       { return len(v.value) == 0 }
+func (v *int16Value) Len() int            { return len(v.value) }
 func (v *int16Value) String() string      { return fmt.Sprintf("%v", v.value) }
 
 type int32Value struct {
 	value []int32
 }
 
-func (v *int32Value) Get() interface{}    { return v.value[0] }
+func (v *int32Value) Get() interface{} {
+	if len(v.value) == 0 {
+		return nil
+	}
+	return v.value[0]
+}
 func (v *int32Value) GetAll() interface{} { return v.value }
+func (v *int32Value) IsEmpty() bool       { return len(v.value) == 0 }
+func (v *int32Value) Len() int            { return len(v.value) }
 func (v *int32Value) String() string      { return fmt.Sprintf("%v", v.value) }
 
+type int64Value struct {
+	value []int64
+}
+
+func (v *int64Value) Get() interface{} {
+	if len(v.value) == 0 {
+		return nil
+	}
+	return v.value[0]
+}
+func (v *int64Value) GetAll() interface{} { return v.value }
+func (v *int64Value) IsEmpty() bool       { return len(v.value) == 0 }
+func (v *int64Value) Len() int            { return len(v.value) }
+func (v *int64Value) String() string      { return fmt.Sprintf("%v", v.value) }
+
+// Multiple values are separated by backslash, except for VRs holding a
+// single value that may contain backslashes
 type stringValue struct {
-	value string
+	value  string
+	single bool
+}
+
+func newStringValue(vr, value string) *stringValue {
+	switch vr {
+	case "LT", "ST", "UT", "UR":
+		return &stringValue{value: nullStrip(value), single: true}
+	}
+	return &stringValue{value: nullStrip(value)}
 }
 
-func (v *stringValue) Get() interface{}    { return strings.TrimSpace(v.value) }
-func (v *stringValue) GetAll() interface{} { return strings.TrimSpace(v.value) }
+// The first value
+func (v *stringValue) Get() interface{} {
+	values := v.values()
+	if len(values) == 0 {
+		return nil
+	}
+	return values[0]
+}
+
+func (v *stringValue) GetAll() interface{} { return v.values() }
+func (v *stringValue) IsEmpty() bool       { return strings.TrimSpace(v.value) == "" }
+func (v *stringValue) Len() int            { return len(v.values()) }
 func (v *stringValue) String() string      { return strings.TrimSpace(v.value) }
 
+func (v *stringValue) values() []string {
+	str := strings.TrimSpace(v.value)
+	if str == "" {
+		return []string{}
+	}
+	if v.single {
+		return []string{str}
+	}
+	values := strings.Split(str, "\\")
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return values
+}
+
 type sqValue struct {
 	value []*Dataset
 }
 
-func (v *sqValue) Get() interface{}    { return v.value[0] }
+func (v *sqValue) Get() interface{} {
+	if len(v.value) == 0 {
+		return nil
+	}
+	return v.value[0]
+}
 func (v *sqValue) GetAll() interface{} { return v.value }
+func (v *sqValue) IsEmpty() bool       { return len(v.value) == 0 }
+func (v *sqValue) Len() int            { return len(v.value) }
 func (v *sqValue) String() string      { return "" }
 
+// Value of an AT element, a tag stored as group and element pair
+type AttributeTag uint32
+
+func (t AttributeTag) String() string {
+	return fmt.Sprintf("(%04x,%04x)", uint32(t)>>16, uint32(t)&0xffff)
+}
+
+type tagValue struct {
+	value []AttributeTag
+}
+
+func (v *tagValue) Get() interface{} {
+	if len(v.value) == 0 {
+		return nil
+	}
+	return v.value[0]
+}
+func (v *tagValue) GetAll() interface{} { return v.value }
+func (v *tagValue) IsEmpty() bool       { return len(v.value) == 0 }
+func (v *tagValue) Len() int            { return len(v.value) }
+func (v *tagValue) String() string      { return fmt.Sprintf("%v", v.value) }
+
 type uint16Value struct {
 	value []uint16
 }
 
-func (v *uint16Value) Get() interface{}    { return v.value[0] }
+func (v *uint16Value) Get() interface{} {
+	if len(v.value) == 0 {
+		return nil
+	}
+	return v.value[0]
+}
 func (v *uint16Value) GetAll() interface{} { return v.value }
+func (v *uint16Value) IsEmpty() bool       { return len(v.value) == 0 }
+func (v *uint16Value) Len() int            { return len(v.value) }
 func (v *uint16Value) String() string      { return fmt.Sprintf("%v", v.value) }
 
 type uint32Value struct {
 	value []uint32
 }
 
-func (v *uint32Value) Get() interface{}    { return v.value[0] }
+func (v *uint32Value) Get() interface{} {
+	if len(v.value) == 0 {
+		return nil
+	}
+	return v.value[0]
+}
 func (v *uint32Value) GetAll() interface{} { return v.value }
+func (v *uint32Value) IsEmpty() bool       { return len(v.value) == 0 }
+func (v *uint32Value) Len() int            { return len(v.value) }
 func (v *uint32Value) String() string      { return fmt.Sprintf("%v", v.value) }
 
+type uint64Value struct {
+	value []uint64
+}
+
+func (v *uint64Value) Get() interface{} {
+	if len(v.value) == 0 {
+		return nil
+	}
+	return v.value[0]
+}
+func (v *uint64Value) GetAll() interface{} { return v.value }
+func (v *uint64Value) IsEmpty() bool       { return len(v.value) == 0 }
+func (v *uint64Value) Len() int            { return len(v.value) }
+func (v *uint64Value) String() string      { return fmt.Sprintf("%v", v.value) }
+
 func nullStrip(in string) string {
 	if len(in) < 2 {
 		return in
@@ -68,6 +68,7 @@ const (
 	UV string = "UV"
 )
 
+var allVRs = make(map[string]struct{})
 var strVRs = make(map[string]struct{})
 
 func IsStringVR(value string) bool {
@@ -75,12 +76,28 @@ func IsStringVR(value string) bool {
 	return ok
 }
 
+func IsVR(value string) bool {
+	_, ok := allVRs[value]
+	return ok
+}
+
 func init() {
+	if len(allVRs) == 0 {
+		initAllVRs()
+	}
 	if len(strVRs) == 0 {
 		initStrVRs()
 	}
 }
 
+func initAllVRs() {
+	for _, value := range []string{AE, AS, AT, CS, DA, DS, DT, FD, FL, IS, LO,
+		LT, OB, OD, OF, OL, OV, OW, PN, SH, SL, SQ, SS, ST, SV, TM, UC, UI, UL,
+		UN, UR, US, UT, UV} {
+		allVRs[value] = struct{}{}
+	}
+}
+
 func initStrVRs() {
 	strVRs[AE] = struct{}{}
 	strVRs[AS] = struct{}{}
@@ -0,0 +1,268 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+	"github.com/JamesDarcy616/dicom/tag"
+)
+
+type Action int
+
+const (
+	// Read the value into the element, sequences are read complete
+	WalkRead Action = iota
+	// Skip over the value without reading it into memory
+	WalkSkip
+	// Walk the elements of each item of a sequence instead of reading it
+	WalkDescend
+	// Stop walking, Walk returns without error
+	WalkStop
+)
+
+// Called with the header of each element before its value is read, path
+// holds the tags of the enclosing sequences. The value is read into elem after
+// WalkRead is returned so elem may be kept for use after the walk. The Parser
+// is locked during the walk so must not be called from the WalkFunc.
+type WalkFunc func(path []uint32, elem *Element) (Action, error)
+
+func (p *Parser) Walk(r io.Reader, explicit bool, fn WalkFunc) error {
+	return p.WalkContext(context.Background(), r, explicit, fn)
+}
+
+// Walk checking ctx for cancellation between elements
+func (p *Parser) WalkContext(ctx context.Context, r io.Reader, explicit bool, fn WalkFunc) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.reset(ctx)
+	reader := NewReader(r, binary.LittleEndian, explicit)
+	_, err := p.walkDataset(reader, nil, fn, UndefinedLength)
+	return err
+}
+
+// Walk a file, the file meta is always read as it is needed for the
+// TransferSyntax and its elements are passed to fn with their values
+func (p *Parser) WalkFile(filename string, fn WalkFunc) error {
+	return p.WalkFileContext(context.Background(), filename, fn)
+}
+
+// WalkFile checking ctx for cancellation between elements
+func (p *Parser) WalkFileContext(ctx context.Context, filename string, fn WalkFunc) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.reset(ctx)
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Start in ExpLE mode for file metadata, changed if there is none
+	reader := p.fileReader(file)
+
+	hasMeta, err := p.checkHeader(reader)
+	if err != nil {
+		return err
+	}
+	if hasMeta {
+		meta := NewDataset()
+		if err := p.parseFileMeta(meta, reader); err != nil {
+			return err
+		}
+		reader, err = p.checkXferSyntax(meta, reader)
+		if err != nil {
+			return err
+		}
+		iter := meta.Iterator()
+		for iter.Next() {
+			action, err := fn(nil, iter.Value())
+			if err != nil {
+				return err
+			}
+			if action == WalkStop {
+				return nil
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+	}
+	_, err = p.walkDataset(reader, nil, fn, UndefinedLength)
+	return err
+}
+
+func (p *Parser) isSequence(elem *Element) bool {
+	return elem.VR == "SQ" || (elem.VR == "UN" && elem.VL == UndefinedLength)
+}
+
+func (p *Parser) skipEncapsulated(r Reader) error {
+	for {
+		tag32, err := p.readTag(r)
+		if err != nil {
+			return err
+		}
+		vl, err := r.ReadUint32()
+		if err != nil {
+			return err
+		}
+		if tag32 == SQDelim {
+			return nil
+		}
+		if err := r.Skip(int64(vl)); err != nil {
+			return err
+		}
+	}
+}
+
+// Skip the value of an element, undefined length values are skipped item by
+// item so are never held in memory. SpecificCharacterSet is still read as the
+// text values that follow depend on it.
+func (p *Parser) skipValue(r Reader, elem *Element) error {
+	if elem.Tag == tag.SpecificCharacterSet {
+		value, err := p.readValue(r, elem.VR, elem.VL)
+		if err != nil {
+			return err
+		}
+		p.setCharset(r, &Element{Tag: elem.Tag, Value: value})
+		return nil
+	}
+	if elem.VL != UndefinedLength {
+		return r.Skip(int64(elem.VL))
+	}
+	if p.isSequence(elem) {
+		skipAll := func(path []uint32, elem *Element) (Action, error) {
+			return WalkSkip, nil
+		}
+		_, err := p.walkSequence(r, nil, skipAll, elem)
+		return err
+	}
+	return p.skipEncapsulated(r)
+}
+
+// Walk the elements of a dataset of the given length, UndefinedLength is used
+// for the top level and undefined length items. Returns true if stopped.
+func (p *Parser) walkDataset(r Reader, path []uint32, fn WalkFunc, length uint32) (bool, error) {
+	limit := r.BytesRead() + uint64(length)
+	for {
+		if length != UndefinedLength && r.BytesRead() >= limit {
+			return false, nil
+		}
+		pos := r.BytesRead()
+		elem, err := p.readElementHeader(r)
+		if err != nil {
+			if dcmerr.IsErrEOF(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		switch elem.Tag {
+		case SQItemDelim:
+			// End of an undefined length item
+			return false, nil
+		case SQItem, SQDelim:
+			return false, dcmerr.Errorf(dcmerr.ErrIO,
+				"unexpected SQ marker %08x at %v (%08x)", elem.Tag, pos, pos)
+		}
+
+		action, err := fn(path, elem)
+		if err != nil {
+			return true, err
+		}
+		switch {
+		case action == WalkStop:
+			return true, nil
+		case action == WalkSkip:
+			if err := p.skipValue(r, elem); err != nil {
+				return false, err
+			}
+		case action == WalkDescend && p.isSequence(elem):
+			// Copy the path so callers may keep it
+			stop, err := p.walkSequence(r, append(path[:len(path):len(path)], elem.Tag), fn, elem)
+			if stop || err != nil {
+				return stop, err
+			}
+		default:
+			if _, err := p.readElementValue(r, elem); err != nil {
+				return false, err
+			}
+		}
+	}
+}
+
+func (p *Parser) walkSequence(r Reader, path []uint32, fn WalkFunc, elem *Element) (bool, error) {
+	if err := p.enterSequence(r); err != nil {
+		return false, err
+	}
+	defer p.leaveSequence()
+	// Undefined length UN is a sequence encoded in ImpLE regardless of TransferSyntax
+	if elem.VR == "UN" {
+		order, explicit := r.ByteOrder(), r.IsExplicit()
+		r.SetByteOrder(binary.LittleEndian)
+		r.SetExplicit(false)
+		defer func() {
+			r.SetByteOrder(order)
+			r.SetExplicit(explicit)
+		}()
+	}
+	// Items inherit the character set unless they specify their own
+	parent := p.charset
+	defer func() { p.charset = parent }()
+	limit := r.BytesRead() + uint64(elem.VL)
+	for {
+		// Defined length SQ has no SQDelim, bail at the end of the value
+		if elem.VL != UndefinedLength && r.BytesRead() >= limit {
+			return false, nil
+		}
+		pos := r.BytesRead()
+		item, err := p.readImplicitElement(r)
+		if err != nil {
+			return false, err
+		}
+		if item.Tag == SQDelim {
+			return false, nil
+		}
+		if item.Tag != SQItem {
+			return false, dcmerr.Errorf(dcmerr.ErrIO,
+				"SQItem tag expected at %v (%08x), found %08x", pos, pos, item.Tag)
+		}
+		p.charset = parent
+		stop, err := p.walkDataset(r, path, fn, item.VL)
+		if stop || err != nil {
+			return stop, err
+		}
+	}
+}
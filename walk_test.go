@@ -0,0 +1,185 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/JamesDarcy616/dicom/tag"
+)
+
+// Walk untilFile with action choosing the action for each element, returning
+// the body elements visited as path/tag and the file meta elements
+func walkVisits(t *testing.T, action func(path []uint32, elem *Element) Action) ([]string, []*Element, error) {
+	t.Helper()
+	var visits []string
+	var meta []*Element
+	err := NewParser().WalkFile(untilFile(t), func(path []uint32, elem *Element) (Action, error) {
+		if elem.Tag>>16 == 0x0002 {
+			if len(visits) > 0 {
+				t.Errorf("meta %08x after the body", elem.Tag)
+			}
+			meta = append(meta, elem)
+			return action(path, elem), nil
+		}
+		visits = append(visits, fmt.Sprintf("%08x%08x", path, elem.Tag))
+		return action(path, elem), nil
+	})
+	return visits, meta, err
+}
+
+func visit(tags ...uint32) string {
+	return fmt.Sprintf("%08x%08x", tags[:len(tags)-1], tags[len(tags)-1])
+}
+
+func TestWalkFile(t *testing.T) {
+	refs := tag.ReferencedImageSequence
+	top := []string{visit(tag.PatientName), visit(tag.PatientID), visit(tag.StudyInstanceUID)}
+	for _, c := range []struct {
+		name   string
+		action func(path []uint32, elem *Element) Action
+		want   []string
+	}{
+		{
+			name: "descend",
+			action: func(path []uint32, elem *Element) Action {
+				if elem.Tag == refs {
+					return WalkDescend
+				}
+				return WalkRead
+			},
+			want: append([]string{visit(tag.SOPInstanceUID), visit(refs),
+				visit(refs, tag.ReferencedSOPClassUID),
+				visit(refs, tag.ReferencedSOPClassUID), visit(refs, tag.ReferencedSOPInstanceUID)}, top...),
+		},
+		{
+			name:   "read",
+			action: func(path []uint32, elem *Element) Action { return WalkRead },
+			want:   append([]string{visit(tag.SOPInstanceUID), visit(refs)}, top...),
+		},
+		{
+			name:   "skip",
+			action: func(path []uint32, elem *Element) Action { return WalkSkip },
+			want:   append([]string{visit(tag.SOPInstanceUID), visit(refs)}, top...),
+		},
+		{
+			name: "stop in sequence",
+			action: func(path []uint32, elem *Element) Action {
+				switch elem.Tag {
+				case refs:
+					return WalkDescend
+				case tag.ReferencedSOPInstanceUID:
+					return WalkStop
+				}
+				return WalkRead
+			},
+			want: []string{visit(tag.SOPInstanceUID), visit(refs),
+				visit(refs, tag.ReferencedSOPClassUID),
+				visit(refs, tag.ReferencedSOPClassUID), visit(refs, tag.ReferencedSOPInstanceUID)},
+		},
+		{
+			name: "stop",
+			action: func(path []uint32, elem *Element) Action {
+				if elem.Tag == tag.PatientName {
+					return WalkStop
+				}
+				return WalkRead
+			},
+			want: []string{visit(tag.SOPInstanceUID), visit(refs), visit(tag.PatientName)},
+		},
+		{
+			name: "stop in meta",
+			action: func(path []uint32, elem *Element) Action {
+				return WalkStop
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			visits, meta, err := walkVisits(t, c.action)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(visits, c.want) {
+				t.Errorf("visited %v, want %v", visits, c.want)
+			}
+			// File meta is passed with its values
+			if len(meta) == 0 || (c.want == nil && len(meta) != 1) {
+				t.Errorf("%v meta elements", len(meta))
+			}
+			for _, elem := range meta {
+				if elem.Value == nil {
+					t.Errorf("meta %08x without value", elem.Tag)
+				}
+			}
+		})
+	}
+}
+
+func TestWalkValues(t *testing.T) {
+	elems := make(map[uint32]*Element)
+	err := NewParser().WalkFile(untilFile(t), func(path []uint32, elem *Element) (Action, error) {
+		if len(path) == 0 {
+			elems[elem.Tag] = elem
+		}
+		if elem.Tag == tag.PatientID {
+			return WalkSkip, nil
+		}
+		return WalkRead, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Elements read are complete after the walk
+	if sq, ok := elems[tag.ReferencedImageSequence].Value.(*sqValue); !ok || len(sq.value) != 2 {
+		t.Errorf("ReferencedImageSequence %v", elems[tag.ReferencedImageSequence].Value)
+	}
+	if name := elems[tag.PatientName].Value.Get(); name != "Doe^John" {
+		t.Errorf("PatientName %v", name)
+	}
+	if elems[tag.PatientID].Value != nil {
+		t.Errorf("skipped PatientID %v", elems[tag.PatientID].Value)
+	}
+
+	wantErr := errors.New("walk error")
+	err = NewParser().WalkFile(untilFile(t), func(path []uint32, elem *Element) (Action, error) {
+		if elem.Tag == tag.PatientName {
+			return WalkRead, wantErr
+		}
+		return WalkRead, nil
+	})
+	if err != wantErr {
+		t.Errorf("Walk error %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright © 2022 James Darcy <jamesd@icr.ac.uk>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software
+   without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package dicom
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/JamesDarcy616/dicom/dcmerr"
+)
+
+type Writer interface {
+	io.Writer
+	ByteOrder() binary.ByteOrder
+	BytesWritten() uint64
+	Flush() error
+	IsExplicit() bool
+	SetByteOrder(binary.ByteOrder)
+	SetExplicit(bool)
+	WriteFloat32(v float32) error
+	WriteFloat64(v float64) error
+	WriteInt16(v int16) error
+	WriteInt32(v int32) error
+	WriteString(s string) error
+	WriteUint16(v uint16) error
+	WriteUint16LE(v uint16) error
+	WriteUint32(v uint32) error
+	WriteUint32LE(v uint32) error
+}
+
+type writer struct {
+	explicit bool
+	out      *bufio.Writer
+	nWritten uint64
+	order    binary.ByteOrder
+}
+
+func NewWriter(w io.Writer, order binary.ByteOrder, explicit bool) Writer {
+	return &writer{
+		explicit: explicit,
+		out:      bufio.NewWriter(w),
+		nWritten: 0,
+		order:    order,
+	}
+}
+
+func (w *writer) ByteOrder() binary.ByteOrder {
+	return w.order
+}
+
+func (w *writer) BytesWritten() uint64 {
+	return w.nWritten
+}
+
+func (w *writer) Flush() error {
+	if err := w.out.Flush(); err != nil {
+		return dcmerr.Errorf(dcmerr.ErrIO,
+			"error flushing at byte %v (%08x) - %v", w.nWritten, w.nWritten, err.Error())
+	}
+	return nil
+}
+
+func (w *writer) IsExplicit() bool {
+	return w.explicit
+}
+
+func (w *writer) SetByteOrder(order binary.ByteOrder) {
+	w.order = order
+}
+
+func (w *writer) SetExplicit(explicit bool) {
+	w.explicit = explicit
+}
+
+func (w *writer) Write(buf []byte) (int, error) {
+	n, err := w.out.Write(buf)
+	// Increment nWritten here as all other Write*() fns use this fn underneath
+	w.nWritten += uint64(n)
+	return n, err
+}
+
+func (w *writer) WriteFloat32(v float32) error {
+	return w.write(w.order, v)
+}
+
+func (w *writer) WriteFloat64(v float64) error {
+	return w.write(w.order, v)
+}
+
+func (w *writer) WriteInt16(v int16) error {
+	return w.write(w.order, v)
+}
+
+func (w *writer) WriteInt32(v int32) error {
+	return w.write(w.order, v)
+}
+
+func (w *writer) WriteString(s string) error {
+	if _, err := io.WriteString(w, s); err != nil {
+		return dcmerr.Errorf(dcmerr.ErrIO,
+			"error near byte %v (%08x) - %v", w.nWritten, w.nWritten, err.Error())
+	}
+	return nil
+}
+
+func (w *writer) WriteUint16(v uint16) error {
+	return w.write(w.order, v)
+}
+
+func (w *writer) WriteUint16LE(v uint16) error {
+	return w.write(binary.LittleEndian, v)
+}
+
+func (w *writer) WriteUint32(v uint32) error {
+	return w.write(w.order, v)
+}
+
+func (w *writer) WriteUint32LE(v uint32) error {
+	return w.write(binary.LittleEndian, v)
+}
+
+func (w *writer) write(order binary.ByteOrder, v any) error {
+	if err := binary.Write(w, order, v); err != nil {
+		return dcmerr.Errorf(dcmerr.ErrIO,
+			"error near byte %v (%08x) - %v", w.nWritten, w.nWritten, err.Error())
+	}
+	return nil
+}